@@ -0,0 +1,35 @@
+package internal
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// generatedComment marks generated files, see https://go.dev/s/generatedcode
+var generatedComment = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// maxHeaderLines limits how far into files without a package clause the comment is looked for
+const maxHeaderLines = 100
+
+// IsGenerated reports whether the file has the comment marking generated code before its package clause
+func IsGenerated(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for i := 0; i < maxHeaderLines && scanner.Scan(); i++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if generatedComment.MatchString(line) {
+			return true, nil
+		}
+		if strings.HasPrefix(line, "package ") {
+			break
+		}
+	}
+	return false, scanner.Err()
+}
@@ -0,0 +1,29 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsGenerated(t *testing.T) {
+	dir := t.TempDir()
+	for name, test := range map[string]struct {
+		content   string
+		generated bool
+	}{
+		"a.pb.go":   {"// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage qf\n", true},
+		"build.go":  {"//go:build linux\n\n// Code generated by hand. DO NOT EDIT.\npackage qf\n", true},
+		"doc.go":    {"// Package qf is not generated.\npackage qf\n", false},
+		"late.go":   {"package qf\n\n// Code generated by hand. DO NOT EDIT.\n", false},
+		"spaced.go": {"//Code generated by hand. DO NOT EDIT.\npackage qf\n", false},
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(test.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if generated, err := IsGenerated(path); err != nil || generated != test.generated {
+			t.Errorf("%s: expected generated %t, got %t, err: %v", name, test.generated, generated, err)
+		}
+	}
+}
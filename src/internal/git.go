@@ -0,0 +1,52 @@
+package internal
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// GitHead returns the commit checked out in the repository containing dir
+func GitHead(dir string) (string, error) {
+	out, err := git(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// GitChangedFiles returns the absolute paths of the files changed since the commit
+// Includes committed, staged and unstaged changes, and untracked files which are not ignored
+func GitChangedFiles(dir, commit string) ([]string, error) {
+	root, err := git(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	root = strings.TrimSpace(root)
+	diff, err := git(dir, "diff", "--name-only", commit)
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := git(dir, "ls-files", "--others", "--exclude-standard", "--full-name")
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, line := range strings.Split(diff+"\n"+untracked, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			paths = append(paths, filepath.Join(root, filepath.FromSlash(line)))
+		}
+	}
+	return paths, nil
+}
+
+func git(dir string, args ...string) (string, error) {
+	c := exec.Command("git", args...)
+	c.Dir = dir
+	out, err := c.Output()
+	if err != nil {
+		return "", fmt.Errorf("error running git %s: %v", strings.Join(args, " "), err)
+	}
+	return string(out), nil
+}
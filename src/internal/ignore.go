@@ -0,0 +1,242 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// IgnoreFiles are read in every directory of the project, patterns in deeper directories take precedence
+var IgnoreFiles = []string{".gitignore", ".refvizignore"}
+
+// Ignore matches paths in the project against gitignore patterns
+// The ignore files of a directory are read the first time a path below it is matched
+type Ignore struct {
+	root string
+	// patterns are the patterns from outside the ignore files, e.g. the config, applied before the root ignore files
+	patterns []pattern
+
+	mu sync.Mutex
+	// dirs caches the patterns of the ignore files in each directory, keyed by the path relative to the root
+	dirs map[string][]pattern
+	// ignored caches why directories are ignored, an empty reason if they are not
+	ignored map[string]string
+}
+
+// pattern is a line of an ignore file
+type pattern struct {
+	re *regexp.Regexp
+	// base is the directory of the ignore file, relative to the root
+	base    string
+	negate  bool
+	dirOnly bool
+	// source is file:line: pattern
+	source string
+}
+
+// NewIgnore creates a matcher for the paths below root
+func NewIgnore(root string) *Ignore {
+	return &Ignore{
+		root:    root,
+		dirs:    make(map[string][]pattern),
+		ignored: make(map[string]string),
+	}
+}
+
+// Add adds patterns relative to the root, source describes where they come from
+func (ig *Ignore) Add(source string, lines ...string) {
+	for i, line := range lines {
+		if p, ok := parsePattern(line, ".", fmt.Sprintf("%s:%d", source, i+1)); ok {
+			ig.patterns = append(ig.patterns, p)
+		}
+	}
+}
+
+// Match returns why the path is ignored, or an empty string if it is not
+// A path is ignored if it, or one of the directories it is in, is ignored
+func (ig *Ignore) Match(path string, isDir bool) string {
+	rel, err := filepath.Rel(ig.root, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	rel = filepath.ToSlash(rel)
+
+	ig.mu.Lock()
+	defer ig.mu.Unlock()
+	// files below an ignored directory can not be included again, as with git
+	if dir := parentDir(rel); dir != "." {
+		if reason := ig.matchDir(dir); reason != "" {
+			return reason
+		}
+	}
+	if isDir {
+		return ig.matchDir(rel)
+	}
+	return ig.match(rel, false)
+}
+
+// matchDir matches the directory and caches the result, must be called with the lock held
+func (ig *Ignore) matchDir(rel string) string {
+	if reason, ok := ig.ignored[rel]; ok {
+		return reason
+	}
+	reason := ""
+	if dir := parentDir(rel); dir != "." {
+		reason = ig.matchDir(dir)
+	}
+	if reason == "" {
+		reason = ig.match(rel, true)
+	}
+	ig.ignored[rel] = reason
+	return reason
+}
+
+// match applies the patterns of the config and of the ignore files above the path, the last matching pattern decides
+func (ig *Ignore) match(rel string, isDir bool) string {
+	reason := ""
+	apply := func(patterns []pattern) {
+		for _, p := range patterns {
+			if p.matches(rel, isDir) {
+				reason = p.source
+				if p.negate {
+					reason = ""
+				}
+			}
+		}
+	}
+	apply(ig.patterns)
+	dir := "."
+	for {
+		apply(ig.load(dir))
+		next, _, found := strings.Cut(strings.TrimPrefix(rel, dir+"/"), "/")
+		if !found {
+			break
+		}
+		if dir == "." {
+			dir = next
+		} else {
+			dir = dir + "/" + next
+		}
+	}
+	return reason
+}
+
+// load reads the ignore files of the directory, must be called with the lock held
+func (ig *Ignore) load(dir string) []pattern {
+	if patterns, ok := ig.dirs[dir]; ok {
+		return patterns
+	}
+	var patterns []pattern
+	for _, name := range IgnoreFiles {
+		path := filepath.Join(ig.root, filepath.FromSlash(dir), name)
+		file, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(file)
+		for i := 1; scanner.Scan(); i++ {
+			source := fmt.Sprintf("%s:%d", filepath.ToSlash(filepath.Join(dir, name)), i)
+			if p, ok := parsePattern(scanner.Text(), dir, source); ok {
+				patterns = append(patterns, p)
+			}
+		}
+		file.Close()
+	}
+	ig.dirs[dir] = patterns
+	return patterns
+}
+
+func (p pattern) matches(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if p.base != "." {
+		if !strings.HasPrefix(rel, p.base+"/") {
+			return false
+		}
+		rel = strings.TrimPrefix(rel, p.base+"/")
+	}
+	return p.re.MatchString(rel)
+}
+
+// parsePattern converts a line of an ignore file to a pattern, returns false for blank lines and comments
+func parsePattern(line, base, source string) (pattern, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return pattern{}, false
+	}
+	p := pattern{base: base, source: fmt.Sprintf("%s: %s", source, line)}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		// \# and \! match a leading # or !
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	// patterns with a slash, other than a trailing one, are relative to the directory of the ignore file
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	expr := globToRegexp(line)
+	if !anchored {
+		expr = "(?:.*/)?" + expr
+	}
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return pattern{}, false
+	}
+	p.re = re
+	return p, true
+}
+
+// globToRegexp converts the glob, where ** matches any number of directories
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+func parentDir(rel string) string {
+	if i := strings.LastIndex(rel, "/"); i >= 0 {
+		return rel[:i]
+	}
+	return "."
+}
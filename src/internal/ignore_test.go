@@ -0,0 +1,52 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnore(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		".gitignore":              "# generated\n*.pb.go\n!keep.pb.go\n/build/\ndocs/**/*.md\n",
+		"web/.refvizignore":       "hooks/testdata/\n",
+		"web/hooks/.gitignore":    "!tmp.go\n",
+		"web/hooks/testdata/a.go": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ig := NewIgnore(root)
+	ig.Add("config", "tmp.go", "node_modules/")
+
+	for _, test := range []struct {
+		path   string
+		isDir  bool
+		reason string
+	}{
+		{"a.pb.go", false, ".gitignore:2: *.pb.go"},
+		{"qf/a.pb.go", false, ".gitignore:2: *.pb.go"},
+		{"qf/keep.pb.go", false, ""},
+		{"build", true, ".gitignore:4: /build/"},
+		{"build/main.go", false, ".gitignore:4: /build/"},
+		{"cmd/build/main.go", false, ""},
+		{"docs/a/b/c.md", false, ".gitignore:5: docs/**/*.md"},
+		{"docs/c.md", false, ".gitignore:5: docs/**/*.md"},
+		{"web/hooks/testdata/a.go", false, "web/.refvizignore:1: hooks/testdata/"},
+		{"hooks/testdata/a.go", false, ""},
+		{"node_modules/x/y.go", false, "config:2: node_modules/"},
+		{"tmp.go", false, "config:1: tmp.go"},
+		{"web/hooks/tmp.go", false, ""},
+	} {
+		if reason := ig.Match(filepath.Join(root, test.path), test.isDir); reason != test.reason {
+			t.Errorf("%s: expected %q, got %q", test.path, test.reason, reason)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package internal
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io/fs"
 	"os"
@@ -11,10 +13,11 @@ import (
 
 const (
 	refVizRootPath = "refVizProjectRoot"
-	tempFolder     = "/refViz"
-	// customPath is used to adjust the root path of the project
-	// This only for development, TODO: remove later
-	customPath = "" // /sample-code/quickfeed
+	tempFolder     = "refViz"
+	// StorageEnv is the environment variable setting the folder of the config, cache and maps
+	StorageEnv = "REFVIZ_STORAGE"
+	// InRepo as storage folder keeps the config, cache and maps in the refViz folder of the project root
+	InRepo = "repo"
 )
 
 func GetMapPath(name string) string {
@@ -37,9 +40,6 @@ func ProjectPath() string {
 	if path == "" {
 		panic("project path not set")
 	}
-	if customPath != "" {
-		path = filepath.Join(path, customPath)
-	}
 	return path
 }
 
@@ -47,33 +47,110 @@ func SetProjectPath(path string) error {
 	return os.Setenv(refVizRootPath, path)
 }
 
+// ProjectRel returns the path relative to the project root, the form paths are stored in the cache and maps
+// Relative paths, and paths on another volume, are returned as they are
+func ProjectRel(path string) string {
+	if !filepath.IsAbs(path) {
+		return path
+	}
+	rel, err := filepath.Rel(ProjectPath(), path)
+	if err != nil {
+		return path
+	}
+	return rel
+}
+
+// ProjectAbs returns the absolute path of a path relative to the project root
+func ProjectAbs(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(ProjectPath(), path)
+}
+
+var (
+	// storagePath is the folder of the config, cache and maps, tempFolder in the project root if it is not set
+	storagePath string
+	// configPath is the config file, in the storage folder if it is not set
+	configPath string
+)
+
+// SetStoragePath keeps the config, cache and maps in the folder, independent of the project root
+func SetStoragePath(path string) {
+	storagePath = path
+}
+
+// SetConfigPath reads and writes the config in the file, instead of in the storage folder
+func SetConfigPath(path string) {
+	configPath = path
+}
+
+// ResolveStorage returns the storage folder of the value given by the flag, environment variable or config
+// InRepo is the refViz folder in the project root, an empty value a folder for the project in the user cache directory
+// Relative paths are relative to base
+func ResolveStorage(storage, base string) (string, error) {
+	switch storage {
+	case InRepo:
+		return RepoStoragePath(), nil
+	case "":
+		return userCachePath()
+	}
+	if !filepath.IsAbs(storage) {
+		storage = filepath.Join(base, storage)
+	}
+	return filepath.Clean(storage), nil
+}
+
+// RepoStoragePath returns the refViz folder in the project root
+func RepoStoragePath() string {
+	return getRootPath(tempFolder)
+}
+
+// userCachePath returns the folder of the project in the user cache directory, $XDG_CACHE_HOME/refviz on Linux
+// The folder is named after the project root and the hash of its path, so projects with the same name do not share it
+func userCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("error getting user cache directory: %v", err)
+	}
+	root := ProjectPath()
+	sum := sha256.Sum256([]byte(root))
+	return filepath.Join(dir, "refviz", fmt.Sprintf("%s-%s", filepath.Base(root), hex.EncodeToString(sum[:8]))), nil
+}
+
 func getRootPath(name string) string {
 	return filepath.Join(ProjectPath(), name)
 }
 
 func ConfigPath() string {
-	return getRootPath(tmp("config.json"))
+	if configPath != "" {
+		return configPath
+	}
+	return tmp("config.json")
 }
 
 func CachePath() string {
-	return getRootPath(tmp("cache.json"))
+	return tmp("cache.json")
 }
 
 func GetTempFolderPath() string {
-	return getRootPath(tempFolder)
+	if storagePath != "" {
+		return storagePath
+	}
+	return RepoStoragePath()
 }
 
-// tmp returns the path of the temporary folder
+// tmp returns the path of the file in the temporary folder
 func tmp(name string) string {
-	return filepath.Join(tempFolder, name)
+	return filepath.Join(GetTempFolderPath(), name)
 }
 
 func MapPath() string {
-	return getRootPath(tmp("maps"))
+	return tmp("maps")
 }
 
 func GraphvizPath() string {
-	return getRootPath(tmp("graphviz"))
+	return tmp("graphviz")
 }
 
 func DotFilePath(mapName *string) string {
@@ -82,13 +159,16 @@ func DotFilePath(mapName *string) string {
 
 // getProjectRoot returns the root directory of the users project
 // If the user is in a git project, it will return the root of the git repository
-// Attempts to find the root of a project, if the user is not in a git repository
-// TODO: This is problematic for non-go projects, solve this
-func GetProjectRoot() (string, error) {
+// Otherwise the directory of a go.work file, so every module of the workspace is in the project
+// Attempts to find the root of a project with the markers, if the user is not in a git repository or workspace
+func GetProjectRoot(markers []string) (string, error) {
 	if gitRoot, err := rootGitProject(); err == nil {
 		return gitRoot, nil
 	}
-	root, err := getRoot()
+	if workRoot, err := findUp("go.work"); err == nil {
+		return workRoot, nil
+	}
+	root, err := getRoot(markers)
 	if err == nil {
 		return root, nil
 	}
@@ -106,19 +186,15 @@ func rootGitProject() (string, error) {
 }
 
 // getRoot attempts to find the root of a project
-// Walks up the directory tree looking for a marker file
+// Walks up the directory tree looking for a marker file, e.g. go.mod
 // If a marker is not found in the directory, it will walk up to the parent directories
-// TODO: Add more markers for different types of projects
 // TODO: Can use the content input of the user to determine the project root faster
-func getRoot() (string, error) {
+func getRoot(markers []string) (string, error) {
 	root, err := os.Getwd()
 	if err != nil {
 		return "", fmt.Errorf("error getting current working directory: %v", err)
 	}
 
-	markers := []string{
-		"go.mod",
-	}
 	found := "found marker"
 
 	if err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
@@ -157,6 +233,24 @@ func getRoot() (string, error) {
 	return "", fmt.Errorf("error getting project root")
 }
 
+// findUp returns the closest directory containing the file, starting from the working directory
+func findUp(name string) (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("error getting current working directory: %v", err)
+	}
+	for {
+		if Exists(filepath.Join(dir, name)) {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("%s not found", name)
+		}
+		dir = parent
+	}
+}
+
 // dirHasMarker checks if a directory has a marker file
 // Returns true if the directory has a marker file
 func dirHasMarker(dir string, markers []string) bool {
@@ -37,7 +37,7 @@ func TestGetRoot(t *testing.T) {
 	}
 
 	// Run the getRoot function
-	detectedRoot, err := getRoot()
+	detectedRoot, err := getRoot([]string{"go.mod"})
 	if err != nil {
 		t.Fatalf("getRoot() returned an error: %v", err)
 	}
@@ -0,0 +1,193 @@
+package lsp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// Backend finds symbols and references in the files of one or more languages
+type Backend interface {
+	Name() string
+	// Symbols returns the symbols declared in the file
+	Symbols(ctx context.Context, path string) ([]DocumentSymbol, error)
+	// References returns the locations referencing the symbol at the position, excluding its declaration
+	References(ctx context.Context, path string, pos Position) ([]Location, error)
+	// Implementations returns the locations of the types implementing the interface at the position
+	Implementations(ctx context.Context, path string, pos Position) ([]Location, error)
+	// Changed drops what the backend knows about the changed or removed file, later queries see its content on disk
+	Changed(ctx context.Context, path string) error
+	Shutdown(ctx context.Context) error
+}
+
+// Factory starts a backend for the project
+type Factory func(ctx context.Context, root string) (Backend, error)
+
+type registration struct {
+	name       string
+	extensions []string
+	markers    []string
+	factory    Factory
+}
+
+var (
+	registryMu  sync.Mutex
+	backends    = make(map[string]*registration) // name -> registration
+	extensions  = make(map[string]string)        // file extension -> name
+	instances   = make(map[string]Backend)       // name -> started backend
+	markerOrder []string
+)
+
+func init() {
+	goMarkers := []string{"go.work", "go.mod"}
+	Register("native", []string{".go"}, goMarkers, func(ctx context.Context, root string) (Backend, error) {
+		return NewNative(root), nil
+	})
+	// registered last, so gopls is the default for Go files
+	Register("gopls", []string{".go"}, goMarkers, func(ctx context.Context, root string) (Backend, error) {
+		return startSession(ctx, root, "gopls", "go", goplsOptions(), "gopls", "serve")
+	})
+}
+
+// Register makes the backend available for the file extensions, replacing earlier registrations for them
+// Markers are files found in the root directory of projects the backend supports, e.g. go.mod
+func Register(name string, exts, markers []string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	backends[name] = &registration{name: name, extensions: exts, markers: markers, factory: factory}
+	for _, ext := range exts {
+		extensions[ext] = name
+	}
+	for _, m := range markers {
+		if !slices.Contains(markerOrder, m) {
+			markerOrder = append(markerOrder, m)
+		}
+	}
+}
+
+// Use selects which of the registered backends handles the file extension
+func Use(ext, name string) error {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	r, ok := backends[name]
+	if !ok {
+		return fmt.Errorf("unknown backend: %s", name)
+	}
+	if !slices.Contains(r.extensions, ext) {
+		return fmt.Errorf("backend %s does not support %s files", name, ext)
+	}
+	extensions[ext] = name
+	return nil
+}
+
+// Supports reports whether a backend is registered for the file extension
+func Supports(ext string) bool {
+	_, ok := BackendName(ext)
+	return ok
+}
+
+// BackendName returns the name of the backend handling the file extension
+func BackendName(ext string) (string, bool) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	name, ok := extensions[ext]
+	return name, ok
+}
+
+// Markers returns the project root markers of all registered backends
+func Markers() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	return slices.Clone(markerOrder)
+}
+
+// For returns the backend for the file, starting it on first use
+// Started backends are shared by all queries until Shutdown is called
+func For(ctx context.Context, root, path string) (Backend, error) {
+	ext := filepath.Ext(path)
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	name, ok := extensions[ext]
+	if !ok {
+		return nil, fmt.Errorf("no backend registered for %s files", ext)
+	}
+	if b, ok := instances[name]; ok {
+		return b, nil
+	}
+	b, err := backends[name].factory(ctx, root)
+	if err != nil {
+		return nil, fmt.Errorf("error starting backend %s: %v", name, err)
+	}
+	instances[name] = b
+	return b, nil
+}
+
+// Changed tells the started backend of the file that it changed or was removed
+// Backends which are not started yet read the file when they start
+func Changed(ctx context.Context, path string) error {
+	registryMu.Lock()
+	b, ok := instances[extensions[filepath.Ext(path)]]
+	registryMu.Unlock()
+	if !ok {
+		return nil
+	}
+	return b.Changed(ctx, path)
+}
+
+// Shutdown stops all started backends
+func Shutdown(ctx context.Context) error {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	var errs []error
+	for name, b := range instances {
+		if err := b.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("error shutting down %s: %v", name, err))
+		}
+		delete(instances, name)
+	}
+	return errors.Join(errs...)
+}
+
+// EnclosingSymbol returns the innermost of the symbols of a file whose full range contains the position
+// Returns nil if the position is not inside a symbol
+func EnclosingSymbol(symbols []DocumentSymbol, pos Position) *DocumentSymbol {
+	return enclosingSymbol(symbols, pos, "")
+}
+
+// enclosingSymbol returns the innermost symbol whose full range contains the position, with its container set
+// The smallest range is chosen on each level, since flat symbol lists contain both classes and their methods
+func enclosingSymbol(symbols []DocumentSymbol, pos Position, container string) *DocumentSymbol {
+	var found *DocumentSymbol
+	for i := range symbols {
+		s := &symbols[i]
+		if s.Range.contains(pos) && (found == nil || s.Range.within(found.Range)) {
+			found = s
+		}
+	}
+	if found == nil {
+		return nil
+	}
+	if child := enclosingSymbol(found.Children, pos, found.Name); child != nil {
+		return child
+	}
+	s := *found
+	if s.Container == "" {
+		s.Container = container
+	}
+	return &s
+}
+
+func (r Range) contains(p Position) bool {
+	return !p.before(r.Start) && p.before(r.End)
+}
+
+func (r Range) within(o Range) bool {
+	return !r.Start.before(o.Start) && !o.End.before(r.End)
+}
+
+func (p Position) before(o Position) bool {
+	return p.Line < o.Line || p.Line == o.Line && p.Character < o.Character
+}
@@ -0,0 +1,64 @@
+package lsp
+
+import (
+	"fmt"
+	"go/build"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	buildMu sync.Mutex
+	// buildCtx decides which Go files are part of the build, the host by default
+	buildCtx = build.Default
+)
+
+// SetBuildContext sets the target the //go:build constraints of Go files are evaluated for
+// Empty values keep the values of the host
+func SetBuildContext(goos, goarch string, tags []string) {
+	buildMu.Lock()
+	defer buildMu.Unlock()
+	buildCtx = build.Default
+	if goos != "" {
+		buildCtx.GOOS = goos
+	}
+	if goarch != "" {
+		buildCtx.GOARCH = goarch
+	}
+	buildCtx.BuildTags = tags
+}
+
+func buildContext() *build.Context {
+	buildMu.Lock()
+	defer buildMu.Unlock()
+	ctx := buildCtx
+	return &ctx
+}
+
+// MatchFile reports whether the Go file is part of the build, checking its name and //go:build constraints
+func MatchFile(path string) (bool, error) {
+	return buildContext().MatchFile(filepath.Dir(path), filepath.Base(path))
+}
+
+// BuildTarget describes the build context, e.g. linux/amd64 or linux/amd64 with tags integration
+func BuildTarget() string {
+	ctx := buildContext()
+	target := fmt.Sprintf("%s/%s", ctx.GOOS, ctx.GOARCH)
+	if len(ctx.BuildTags) > 0 {
+		target += " with tags " + strings.Join(ctx.BuildTags, ",")
+	}
+	return target
+}
+
+// goplsOptions are the initialization options making gopls use the build context
+func goplsOptions() map[string]any {
+	ctx := buildContext()
+	options := map[string]any{
+		"env": map[string]string{"GOOS": ctx.GOOS, "GOARCH": ctx.GOARCH},
+	}
+	if len(ctx.BuildTags) > 0 {
+		options["buildFlags"] = []string{"-tags=" + strings.Join(ctx.BuildTags, ",")}
+	}
+	return options
+}
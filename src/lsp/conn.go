@@ -0,0 +1,262 @@
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Conn is a JSON-RPC 2.0 connection to a language server over stdio
+type Conn struct {
+	cmd    *exec.Cmd
+	in     io.WriteCloser
+	out    *bufio.Reader
+	stderr *tail
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan *message
+	done    chan struct{}
+	err     error
+}
+
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  any              `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *ResponseError   `json:"error,omitempty"`
+}
+
+type ResponseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// ServerError is a failed call to the server
+type ServerError struct {
+	Err    error
+	stderr *tail
+}
+
+func (e *ServerError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ServerError) Unwrap() error {
+	return e.Err
+}
+
+// Stderr returns the latest output of the server on stderr
+// Read when needed, since the output is copied in the background and may arrive after the response
+func (e *ServerError) Stderr() string {
+	return e.stderr.String()
+}
+
+// stderrLimit is the number of bytes kept from the stderr of the server
+const stderrLimit = 4096
+
+// tail keeps the last bytes written to it
+type tail struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (t *tail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > stderrLimit {
+		t.buf = t.buf[len(t.buf)-stderrLimit:]
+	}
+	return len(p), nil
+}
+
+func (t *tail) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return strings.TrimSpace(string(t.buf))
+}
+
+// dial starts the language server in dir and reads its responses in the background
+func dial(dir, name string, args ...string) (*Conn, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	stderr := &tail{}
+	cmd.Stderr = stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("error creating stdin pipe: %v", err)
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("error creating stdout pipe: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("error starting %s: %v", name, err)
+	}
+	c := &Conn{
+		cmd:     cmd,
+		in:      in,
+		out:     bufio.NewReader(out),
+		stderr:  stderr,
+		pending: make(map[int64]chan *message),
+		done:    make(chan struct{}),
+	}
+	go c.read()
+	return c, nil
+}
+
+// Call sends a request and waits for the response, or until the context is done
+// Errors are returned as a ServerError
+func (c *Conn) Call(ctx context.Context, method string, params, result any) error {
+	if err := c.call(ctx, method, params, result); err != nil {
+		return &ServerError{Err: err, stderr: c.stderr}
+	}
+	return nil
+}
+
+func (c *Conn) call(ctx context.Context, method string, params, result any) error {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	c.nextID++
+	id := c.nextID
+	ch := make(chan *message, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	raw := json.RawMessage(strconv.FormatInt(id, 10))
+	if err := c.write(&message{ID: &raw, Method: method, Params: params}); err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		// let the server know the result is no longer needed
+		_ = c.Notify("$/cancelRequest", map[string]int64{"id": id})
+		return fmt.Errorf("%s: %v", method, ctx.Err())
+	case <-c.done:
+		return c.err
+	case resp := <-ch:
+		if resp.Error != nil {
+			return fmt.Errorf("%s: %w", method, resp.Error)
+		}
+		if result == nil || len(resp.Result) == 0 {
+			return nil
+		}
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("error unmarshaling %s result: %v", method, err)
+		}
+		return nil
+	}
+}
+
+// Notify sends a notification, which the server does not respond to
+func (c *Conn) Notify(method string, params any) error {
+	return c.write(&message{Method: method, Params: params})
+}
+
+// Close closes stdin of the server and waits for it to exit
+func (c *Conn) Close() error {
+	c.in.Close()
+	return c.cmd.Wait()
+}
+
+func (c *Conn) write(m *message) error {
+	m.JSONRPC = "2.0"
+	body, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("error marshalling %s: %v", m.Method, err)
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := fmt.Fprintf(c.in, "Content-Length: %d\r\n\r\n%s", len(body), body); err != nil {
+		return fmt.Errorf("error writing %s: %v", m.Method, err)
+	}
+	return nil
+}
+
+// read dispatches responses to the waiting callers until the server closes stdout
+func (c *Conn) read() {
+	var err error
+	for {
+		var m *message
+		if m, err = readMessage(c.out); err != nil {
+			break
+		}
+		switch {
+		case m.ID != nil && m.Method != "":
+			// requests from the server, e.g. window/workDoneProgress/create, are acknowledged with a null result
+			_ = c.write(&message{ID: m.ID, Result: json.RawMessage("null")})
+		case m.ID != nil:
+			id, err := strconv.ParseInt(string(*m.ID), 10, 64)
+			if err != nil {
+				continue
+			}
+			c.mu.Lock()
+			ch, ok := c.pending[id]
+			c.mu.Unlock()
+			if ok {
+				ch <- m
+			}
+		}
+		// notifications such as diagnostics and log messages are ignored
+	}
+	c.mu.Lock()
+	c.err = fmt.Errorf("connection to language server closed: %v", err)
+	c.mu.Unlock()
+	close(c.done)
+}
+
+// readMessage reads a single message with its Content-Length header
+func readMessage(r *bufio.Reader) (*message, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if v, ok := strings.CutPrefix(line, "Content-Length:"); ok {
+			if length, err = strconv.Atoi(strings.TrimSpace(v)); err != nil {
+				return nil, fmt.Errorf("invalid content length: %s", v)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("missing content length header")
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	var m message
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, fmt.Errorf("error unmarshaling message: %v", err)
+	}
+	return &m, nil
+}
@@ -0,0 +1,37 @@
+package lsp
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestReadMessage(t *testing.T) {
+	body := `{"jsonrpc":"2.0","id":1,"result":[{"uri":"file:///tmp/a.go"}]}`
+	input := "Content-Length: " + strconv.Itoa(len(body)) + "\r\nContent-Type: application/vscode-jsonrpc; charset=utf-8\r\n\r\n" + body
+
+	m, err := readMessage(bufio.NewReader(strings.NewReader(input)))
+	if err != nil {
+		t.Fatalf("readMessage() returned an error: %v", err)
+	}
+	if m.ID == nil || string(*m.ID) != "1" {
+		t.Errorf("Expected id 1, got: %v", m.ID)
+	}
+	if string(m.Result) != `[{"uri":"file:///tmp/a.go"}]` {
+		t.Errorf("Unexpected result: %s", m.Result)
+	}
+}
+
+func TestReadMessageMissingLength(t *testing.T) {
+	if _, err := readMessage(bufio.NewReader(strings.NewReader("\r\n{}"))); err == nil {
+		t.Error("Expected an error when the content length header is missing")
+	}
+}
+
+func TestPathURI(t *testing.T) {
+	path := "/home/user/my project/main.go"
+	if got := Path(URI(path)); got != path {
+		t.Errorf("Expected path: %s, got: %s", path, got)
+	}
+}
@@ -0,0 +1,114 @@
+package lsp
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Module is a Go module of the workspace
+type Module struct {
+	Dir  string
+	Path string
+}
+
+// Modules returns the modules of the workspace in root, sorted with the innermost first
+// The modules are the ones used by the go.work file in root, and every go.mod file found below root
+func Modules(root string) ([]Module, error) {
+	_, modules, err := packageDirs(root)
+	return modules, err
+}
+
+// packageDirs returns the directories containing Go files and the modules of the workspace in root
+// Modules used by go.work outside of root are walked as well
+// testdata, vendor and hidden directories are skipped, modules are sorted with the innermost first
+func packageDirs(root string) ([]string, []Module, error) {
+	roots := []string{root}
+	for _, dir := range workModules(root) {
+		if rel, err := filepath.Rel(root, dir); err != nil || strings.HasPrefix(rel, "..") {
+			roots = append(roots, dir)
+		}
+	}
+
+	var dirs []string
+	var modules []Module
+	for _, r := range roots {
+		err := filepath.WalkDir(r, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() {
+				return nil
+			}
+			name := d.Name()
+			if path != r && (name == "testdata" || name == "vendor" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			if m := modulePath(path); m != "" {
+				modules = append(modules, Module{Dir: path, Path: m})
+			}
+			if matches, _ := filepath.Glob(filepath.Join(path, "*.go")); len(matches) > 0 {
+				dirs = append(dirs, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("error walking through directory: %s, err: %v", r, err)
+		}
+	}
+	sort.SliceStable(modules, func(i, j int) bool {
+		return strings.Count(modules[i].Dir, string(filepath.Separator)) > strings.Count(modules[j].Dir, string(filepath.Separator))
+	})
+	return dirs, modules, nil
+}
+
+// workModules returns the absolute directories of the use directives in the go.work file in root
+func workModules(root string) []string {
+	content, err := os.ReadFile(filepath.Join(root, "go.work"))
+	if err != nil {
+		return nil
+	}
+	var dirs []string
+	var block bool
+	for _, line := range strings.Split(string(content), "\n") {
+		line, _, _ = strings.Cut(line, "//")
+		line = strings.TrimSpace(line)
+		switch {
+		case block && line == ")":
+			block = false
+			continue
+		case line == "use (" || line == "use(":
+			block = true
+			continue
+		case !block:
+			var ok bool
+			if line, ok = strings.CutPrefix(line, "use "); !ok {
+				continue
+			}
+		}
+		if dir := strings.Trim(strings.TrimSpace(line), `"`); dir != "" {
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(root, filepath.FromSlash(dir))
+			}
+			dirs = append(dirs, filepath.Clean(dir))
+		}
+	}
+	return dirs
+}
+
+// modulePath reads the module path from the go.mod file in root
+func modulePath(root string) string {
+	content, err := os.ReadFile(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if m, ok := strings.CutPrefix(strings.TrimSpace(line), "module "); ok {
+			return strings.Trim(strings.TrimSpace(m), `"`)
+		}
+	}
+	return ""
+}
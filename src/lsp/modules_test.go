@@ -0,0 +1,51 @@
+package lsp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestModules(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "repo")
+	files := map[string]string{
+		"repo/go.work":         "go 1.22\n\nuse (\n\t./api // the api\n\t../shared\n)\nuse ./tools\n",
+		"repo/api/go.mod":      "module example.com/api\n",
+		"repo/api/v2/go.mod":   "module example.com/api/v2\n",
+		"repo/tools/go.mod":    "module \"example.com/tools\"\n",
+		"repo/testdata/go.mod": "module example.com/testdata\n",
+		"shared/go.mod":        "module example.com/shared\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	modules, err := Modules(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"example.com/api":    filepath.Join(root, "api"),
+		"example.com/api/v2": filepath.Join(root, "api", "v2"),
+		"example.com/tools":  filepath.Join(root, "tools"),
+		"example.com/shared": filepath.Join(dir, "shared"),
+	}
+	if len(modules) != len(want) {
+		t.Fatalf("expected %d modules, got %+v", len(want), modules)
+	}
+	for _, m := range modules {
+		if want[m.Path] != m.Dir {
+			t.Errorf("expected %s in %s, got %s", m.Path, want[m.Path], m.Dir)
+		}
+	}
+	if modules[0].Path != "example.com/api/v2" {
+		t.Errorf("expected the innermost module first, got %s", modules[0].Path)
+	}
+}
@@ -0,0 +1,495 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Native analyses Go code with the standard library, it does not need gopls
+// Packages of the workspace are type checked from source, standard library packages with the source importer
+// The workspace is the modules used by the go.work file in the root and the go.mod files below it
+// Packages from other modules are replaced by empty packages, so references through their types are not found
+type Native struct {
+	root string
+
+	mu       sync.Mutex
+	loaded   bool
+	fset     *token.FileSet
+	modules  []Module
+	std      types.Importer
+	packages map[string]*nativePackage // import path -> package
+}
+
+// nativeSnapshot are the type checked packages a query runs on, Changed may drop packages while it runs
+type nativeSnapshot struct {
+	fset     *token.FileSet
+	packages []*nativePackage
+}
+
+type nativePackage struct {
+	dir      string
+	files    []*ast.File
+	pkg      *types.Package
+	info     *types.Info
+	checking bool
+}
+
+func NewNative(root string) *Native {
+	return &Native{root: root}
+}
+
+func (n *Native) Name() string {
+	return "native"
+}
+
+// Changed drops the packages in the directory of the file and the packages importing them
+// They are type checked again by the next query, the other packages are kept
+func (n *Native) Changed(ctx context.Context, path string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.packages == nil {
+		return nil
+	}
+	dropped := make(map[string]bool)
+	for importPath, p := range n.packages {
+		if p.dir == filepath.Dir(path) {
+			dropped[importPath] = true
+		}
+	}
+	// packages importing a dropped package refer to its old objects
+	for changed := len(dropped) > 0; changed; {
+		changed = false
+		for importPath, p := range n.packages {
+			if dropped[importPath] || p.pkg == nil {
+				continue
+			}
+			for _, imp := range p.pkg.Imports() {
+				if dropped[imp.Path()] {
+					dropped[importPath] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	for importPath := range dropped {
+		delete(n.packages, importPath)
+	}
+	// new directories are found by the next load
+	n.loaded = false
+	return nil
+}
+
+// Shutdown releases the type checked packages
+func (n *Native) Shutdown(ctx context.Context) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.loaded = false
+	n.packages = nil
+	return nil
+}
+
+// Symbols returns the symbols declared in the file, named and nested the same way as gopls does
+func (n *Native) Symbols(ctx context.Context, path string) ([]DocumentSymbol, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, nil, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing file: %s, err: %v", path, err)
+	}
+	var symbols []DocumentSymbol
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			s := newDocumentSymbol(fset, d.Name.Name, "Function", d, d.Name)
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				s.Name = fmt.Sprintf("(%s).%s", types.ExprString(d.Recv.List[0].Type), d.Name.Name)
+				s.Kind = kindOf("Method")
+			}
+			symbols = append(symbols, s)
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				symbols = append(symbols, specSymbols(fset, d.Tok, spec)...)
+			}
+		}
+	}
+	return symbols, nil
+}
+
+func specSymbols(fset *token.FileSet, tok token.Token, spec ast.Spec) []DocumentSymbol {
+	switch s := spec.(type) {
+	case *ast.TypeSpec:
+		t := newDocumentSymbol(fset, s.Name.Name, "Class", s, s.Name)
+		switch typ := s.Type.(type) {
+		case *ast.StructType:
+			t.Kind = kindOf("Struct")
+			t.Children = fieldSymbols(fset, typ.Fields, "Field")
+		case *ast.InterfaceType:
+			t.Kind = kindOf("Interface")
+			t.Children = fieldSymbols(fset, typ.Methods, "Method")
+		}
+		return []DocumentSymbol{t}
+	case *ast.ValueSpec:
+		kind := "Variable"
+		if tok == token.CONST {
+			kind = "Constant"
+		}
+		var symbols []DocumentSymbol
+		for _, name := range s.Names {
+			if name.Name == "_" {
+				continue
+			}
+			symbols = append(symbols, newDocumentSymbol(fset, name.Name, kind, s, name))
+		}
+		return symbols
+	}
+	return nil
+}
+
+// fieldSymbols returns struct fields and interface methods, embedded fields are named after their type
+func fieldSymbols(fset *token.FileSet, fields *ast.FieldList, kind string) []DocumentSymbol {
+	var symbols []DocumentSymbol
+	for _, field := range fields.List {
+		if len(field.Names) == 0 {
+			id := embeddedName(field.Type)
+			symbols = append(symbols, newDocumentSymbol(fset, id.Name, "Field", field, id))
+			continue
+		}
+		k := kind
+		if _, ok := field.Type.(*ast.FuncType); !ok {
+			k = "Field"
+		}
+		for _, name := range field.Names {
+			symbols = append(symbols, newDocumentSymbol(fset, name.Name, k, field, name))
+		}
+	}
+	return symbols
+}
+
+// embeddedName returns the type name of an embedded field, *pkg.T[K] -> T
+func embeddedName(expr ast.Expr) *ast.Ident {
+	for {
+		switch e := expr.(type) {
+		case *ast.Ident:
+			return e
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.SelectorExpr:
+			expr = e.Sel
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		default:
+			return &ast.Ident{Name: types.ExprString(expr), NamePos: expr.Pos()}
+		}
+	}
+}
+
+func newDocumentSymbol(fset *token.FileSet, name, kind string, node, selection ast.Node) DocumentSymbol {
+	return DocumentSymbol{
+		Name:           name,
+		Kind:           kindOf(kind),
+		Range:          nodeRange(fset, node),
+		SelectionRange: nodeRange(fset, selection),
+	}
+}
+
+func kindOf(name string) SymbolKind {
+	for i, k := range symbolKinds {
+		if k == name {
+			return SymbolKind(i + 1)
+		}
+	}
+	return 0
+}
+
+func nodeRange(fset *token.FileSet, node ast.Node) Range {
+	return Range{Start: position(fset, node.Pos()), End: position(fset, node.End())}
+}
+
+// position converts a token position to a zero based protocol position
+// Characters are counted in bytes, which matches UTF-16 for ASCII source code
+func position(fset *token.FileSet, pos token.Pos) Position {
+	p := fset.Position(pos)
+	return Position{Line: p.Line - 1, Character: p.Column - 1}
+}
+
+// References returns the locations referencing the symbol at the given position, excluding its declaration
+func (n *Native) References(ctx context.Context, path string, pos Position) ([]Location, error) {
+	s, err := n.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	target := s.objectAt(path, pos)
+	if target == nil {
+		return nil, fmt.Errorf("no symbol found at %s:%d:%d", path, pos.Line+1, pos.Character+1)
+	}
+	var locations []Location
+	for _, p := range s.packages {
+		for id, obj := range p.info.Uses {
+			if origin(obj) != target {
+				continue
+			}
+			locations = append(locations, Location{
+				URI:   URI(s.fset.Position(id.Pos()).Filename),
+				Range: nodeRange(s.fset, id),
+			})
+		}
+	}
+	return locations, ctx.Err()
+}
+
+// Implementations returns the named types of the module implementing the interface at the position
+// Both the type and its pointer are checked, empty interfaces are ignored since every type implements them
+func (n *Native) Implementations(ctx context.Context, path string, pos Position) ([]Location, error) {
+	s, err := n.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	target := s.objectAt(path, pos)
+	if target == nil {
+		return nil, fmt.Errorf("no symbol found at %s:%d:%d", path, pos.Line+1, pos.Character+1)
+	}
+	iface, ok := target.Type().Underlying().(*types.Interface)
+	if !ok || iface.NumMethods() == 0 {
+		return nil, nil
+	}
+	var locations []Location
+	for _, p := range s.packages {
+		for id, obj := range p.info.Defs {
+			tn, ok := obj.(*types.TypeName)
+			if !ok || tn.IsAlias() || obj.Parent() != obj.Pkg().Scope() {
+				continue
+			}
+			named, ok := tn.Type().(*types.Named)
+			if !ok || named.TypeParams() != nil || types.IsInterface(named) {
+				continue
+			}
+			if implements(named, iface) {
+				locations = append(locations, Location{
+					URI:   URI(s.fset.Position(id.Pos()).Filename),
+					Range: nodeRange(s.fset, id),
+				})
+			}
+		}
+	}
+	return locations, ctx.Err()
+}
+
+// implements reports whether the type or its pointer implements the interface
+// Every method must be found, types.Implements accepts types embedding unresolved packages
+func implements(named *types.Named, iface *types.Interface) bool {
+	ptr := types.NewPointer(named)
+	if !types.Implements(named, iface) && !types.Implements(ptr, iface) {
+		return false
+	}
+	for i := range iface.NumMethods() {
+		m := iface.Method(i)
+		if obj, _, _ := types.LookupFieldOrMethod(ptr, false, m.Pkg(), m.Name()); obj == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// objectAt returns the object declared or used by the identifier at the position
+func (s *nativeSnapshot) objectAt(path string, pos Position) types.Object {
+	for _, p := range s.packages {
+		if p.dir != filepath.Dir(path) {
+			continue
+		}
+		for _, m := range []map[*ast.Ident]types.Object{p.info.Defs, p.info.Uses} {
+			for id, obj := range m {
+				if obj == nil {
+					continue
+				}
+				r := nodeRange(s.fset, id)
+				if s.fset.Position(id.Pos()).Filename == path && r.Start.Line == pos.Line &&
+					r.Start.Character <= pos.Character && pos.Character <= r.End.Character {
+					return origin(obj)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// origin maps instantiated generic functions and fields to their declaration
+func origin(obj types.Object) types.Object {
+	switch o := obj.(type) {
+	case *types.Func:
+		return o.Origin()
+	case *types.Var:
+		return o.Origin()
+	}
+	return obj
+}
+
+// load type checks every package of the module once, packages dropped by Changed are checked again
+// Returns a snapshot of the packages, so queries do not read the packages while Changed drops them
+func (n *Native) load(ctx context.Context) (*nativeSnapshot, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.loaded {
+		return n.snapshot(), nil
+	}
+	if n.packages == nil {
+		n.fset = token.NewFileSet()
+		n.std = importer.ForCompiler(n.fset, "source", nil)
+		n.packages = make(map[string]*nativePackage)
+	}
+
+	dirs, modules, err := packageDirs(n.root)
+	if err != nil {
+		return nil, err
+	}
+	n.modules = modules
+	for _, dir := range dirs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if _, err := n.check(dir); err != nil {
+			return nil, fmt.Errorf("error loading package: %s, err: %v", dir, err)
+		}
+	}
+	n.loaded = true
+	return n.snapshot(), nil
+}
+
+// snapshot copies the packages, must be called with the backend locked
+func (n *Native) snapshot() *nativeSnapshot {
+	s := &nativeSnapshot{fset: n.fset, packages: make([]*nativePackage, 0, len(n.packages))}
+	for _, p := range n.packages {
+		s.packages = append(s.packages, p)
+	}
+	return s
+}
+
+// check parses and type checks the package in dir, type errors are ignored
+// Test files are checked with the package, external test packages are checked separately
+func (n *Native) check(dir string) (*nativePackage, error) {
+	importPath := n.importPath(dir)
+	if p, ok := n.packages[importPath]; ok {
+		if p.checking {
+			return nil, fmt.Errorf("import cycle through: %s", importPath)
+		}
+		return p, nil
+	}
+	p := &nativePackage{dir: dir, checking: true}
+	n.packages[importPath] = p
+
+	files, testFiles, err := n.parseDir(dir)
+	if err != nil {
+		delete(n.packages, importPath)
+		return nil, err
+	}
+	p.files = files
+	p.pkg, p.info = n.typeCheck(importPath, files)
+	p.checking = false
+
+	// external tests may import the package itself, so they are checked after it
+	if len(testFiles) > 0 {
+		t := &nativePackage{dir: dir, files: testFiles}
+		t.pkg, t.info = n.typeCheck(importPath+"_test", testFiles)
+		n.packages[importPath+"_test"] = t
+	}
+	return p, nil
+}
+
+func (n *Native) typeCheck(importPath string, files []*ast.File) (*types.Package, *types.Info) {
+	info := &types.Info{
+		Defs: make(map[*ast.Ident]types.Object),
+		Uses: make(map[*ast.Ident]types.Object),
+	}
+	conf := types.Config{
+		Importer:    importerFunc(n.importPackage),
+		Error:       func(error) {},
+		FakeImportC: true,
+	}
+	pkg, _ := conf.Check(importPath, n.fset, files, info)
+	return pkg, info
+}
+
+// parseDir parses the files in dir which match the build context
+// Files of an external test package, package x_test, are returned separately
+func (n *Native) parseDir(dir string) ([]*ast.File, []*ast.File, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading directory: %s, err: %v", dir, err)
+	}
+	var files, testFiles []*ast.File
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".go") {
+			continue
+		}
+		if ok, err := buildContext().MatchFile(dir, name); err != nil || !ok {
+			continue
+		}
+		f, err := parser.ParseFile(n.fset, filepath.Join(dir, name), nil, parser.SkipObjectResolution)
+		if err != nil && f == nil {
+			continue
+		}
+		if strings.HasSuffix(f.Name.Name, "_test") && strings.HasSuffix(name, "_test.go") {
+			testFiles = append(testFiles, f)
+		} else {
+			files = append(files, f)
+		}
+	}
+	return files, testFiles, nil
+}
+
+func (n *Native) importPackage(path string) (*types.Package, error) {
+	for _, m := range n.modules {
+		if rel, ok := strings.CutPrefix(path, m.Path); ok && (rel == "" || rel[0] == '/') {
+			p, err := n.check(filepath.Join(m.Dir, filepath.FromSlash(rel)))
+			if err != nil {
+				return nil, err
+			}
+			return p.pkg, nil
+		}
+	}
+	if isStd(path) {
+		if pkg, err := n.std.Import(path); err == nil {
+			return pkg, nil
+		}
+	}
+	// unresolved packages are replaced by an empty package
+	pkg := types.NewPackage(path, filepath.Base(path))
+	pkg.MarkComplete()
+	return pkg, nil
+}
+
+// importPath derives the import path of the package in dir from the closest enclosing module
+func (n *Native) importPath(dir string) string {
+	for _, m := range n.modules {
+		rel, err := filepath.Rel(m.Dir, dir)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		if rel == "." {
+			return m.Path
+		}
+		return m.Path + "/" + filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(dir)
+}
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) { return f(path) }
+
+// isStd reports whether the import path belongs to the standard library, which never has a dot in its first element
+func isStd(path string) bool {
+	first, _, _ := strings.Cut(path, "/")
+	return !strings.Contains(first, ".")
+}
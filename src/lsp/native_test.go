@@ -0,0 +1,129 @@
+package lsp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+const nativeTestCode = `package shapes
+
+type Shape interface {
+	Area() float64
+}
+
+type Square struct {
+	Side float64
+}
+
+func (s *Square) Area() float64 {
+	return s.Side * s.Side
+}
+
+func Total(shapes ...Shape) float64 {
+	var sum float64
+	for _, s := range shapes {
+		sum += s.Area()
+	}
+	return sum
+}
+`
+
+func TestNative(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "go.mod"), []byte("module example.com/shapes\n"), 0644); err != nil {
+		t.Fatalf("Failed to create go.mod: %v", err)
+	}
+	path := filepath.Join(root, "shapes.go")
+	if err := os.WriteFile(path, []byte(nativeTestCode), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	n := NewNative(root)
+	symbols, err := n.Symbols(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Symbols() returned an error: %v", err)
+	}
+	want := map[string]string{"Shape": "Interface", "Square": "Struct", "(*Square).Area": "Method", "Total": "Function"}
+	if len(symbols) != len(want) {
+		t.Fatalf("Expected %d symbols, got: %d", len(want), len(symbols))
+	}
+	for _, s := range symbols {
+		if want[s.Name] != s.Kind.String() {
+			t.Errorf("Expected %s to be a %s, got: %s", s.Name, want[s.Name], s.Kind)
+		}
+	}
+
+	// references to the Side field, declared at line 8, column 2
+	refs, err := n.References(context.Background(), path, Position{Line: 7, Character: 1})
+	if err != nil {
+		t.Fatalf("References() returned an error: %v", err)
+	}
+	if len(refs) != 2 {
+		t.Fatalf("Expected 2 references, got: %d", len(refs))
+	}
+	for _, ref := range refs {
+		if Path(ref.URI) != path || ref.Range.Start.Line != 11 {
+			t.Errorf("Unexpected reference: %+v", ref)
+		}
+	}
+}
+
+func TestNativeChanged(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "go.mod"), []byte("module example.com/shapes\n"), 0644); err != nil {
+		t.Fatalf("Failed to create go.mod: %v", err)
+	}
+	path := filepath.Join(root, "shapes.go")
+	if err := os.WriteFile(path, []byte(nativeTestCode), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	ctx := context.Background()
+	n := NewNative(root)
+	side := Position{Line: 7, Character: 1}
+	if refs, err := n.References(ctx, path, side); err != nil || len(refs) != 2 {
+		t.Fatalf("Expected 2 references, got: %d, err: %v", len(refs), err)
+	}
+
+	// a new file in the package, using the field once more
+	other := filepath.Join(root, "double.go")
+	if err := os.WriteFile(other, []byte("package shapes\n\nfunc Double(s *Square) float64 {\n\treturn 2 * s.Side\n}\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := n.Changed(ctx, other); err != nil {
+		t.Fatalf("Changed() returned an error: %v", err)
+	}
+	if refs, err := n.References(ctx, path, side); err != nil || len(refs) != 3 {
+		t.Fatalf("Expected 3 references after the change, got: %d, err: %v", len(refs), err)
+	}
+
+	if err := os.Remove(other); err != nil {
+		t.Fatalf("Failed to remove source file: %v", err)
+	}
+	if err := n.Changed(ctx, other); err != nil {
+		t.Fatalf("Changed() returned an error: %v", err)
+	}
+	if refs, err := n.References(ctx, path, side); err != nil || len(refs) != 2 {
+		t.Fatalf("Expected 2 references after the removal, got: %d, err: %v", len(refs), err)
+	}
+
+	// queries running while the package is dropped by other queries use the packages they started with
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				if err := n.Changed(ctx, path); err != nil {
+					t.Errorf("Changed() returned an error: %v", err)
+				}
+				if refs, err := n.References(ctx, path, side); err != nil || len(refs) != 2 {
+					t.Errorf("Expected 2 references while changing, got: %d, err: %v", len(refs), err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,104 @@
+package lsp
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// Subset of the language server protocol used by RefViz
+// https://microsoft.github.io/language-server-protocol/specifications/lsp/3.17/specification/
+
+// Position is zero based, as defined by the protocol
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+type Location struct {
+	URI   string `json:"uri"`
+	Range Range  `json:"range"`
+}
+
+type DocumentSymbol struct {
+	Name   string `json:"name"`
+	Detail string `json:"detail,omitempty"`
+	// Container is the name of the parent symbol, e.g. the struct of a field
+	// Filled in by RefViz for nested symbols, flat symbol information provides it as containerName
+	Container      string           `json:"containerName,omitempty"`
+	Kind           SymbolKind       `json:"kind"`
+	Range          Range            `json:"range"`
+	SelectionRange Range            `json:"selectionRange"`
+	Children       []DocumentSymbol `json:"children,omitempty"`
+}
+
+type SymbolKind int
+
+var symbolKinds = []string{
+	"File", "Module", "Namespace", "Package", "Class", "Method", "Property", "Field", "Constructor",
+	"Enum", "Interface", "Function", "Variable", "Constant", "String", "Number", "Boolean", "Array",
+	"Object", "Key", "Null", "EnumMember", "Struct", "Event", "Operator", "TypeParameter",
+}
+
+// String returns the name of the kind, the same names gopls prints in its command line output
+func (k SymbolKind) String() string {
+	if k < 1 || int(k) > len(symbolKinds) {
+		return "Unknown"
+	}
+	return symbolKinds[k-1]
+}
+
+type textDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type textDocumentItem struct {
+	URI        string `json:"uri"`
+	LanguageID string `json:"languageId"`
+	Version    int    `json:"version"`
+	Text       string `json:"text"`
+}
+
+// fileEvent is a change of a file on disk, sent with workspace/didChangeWatchedFiles
+type fileEvent struct {
+	URI  string `json:"uri"`
+	Type int    `json:"type"`
+}
+
+// types of file events
+const (
+	fileCreated = iota + 1
+	fileChanged
+	fileDeleted
+)
+
+type textDocumentPositionParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+	Position     Position               `json:"position"`
+}
+
+type referenceParams struct {
+	textDocumentPositionParams
+	Context struct {
+		IncludeDeclaration bool `json:"includeDeclaration"`
+	} `json:"context"`
+}
+
+// URI converts an absolute file path to a file URI
+func URI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// Path converts a file URI to an absolute file path
+func Path(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return strings.TrimPrefix(uri, "file://")
+	}
+	return filepath.FromSlash(u.Path)
+}
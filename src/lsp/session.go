@@ -0,0 +1,224 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Session is a backend for a long lived language server process, speaking the protocol over stdio
+// Queries share the process, so the workspace is only loaded once
+type Session struct {
+	conn       *Conn
+	name       string
+	root       string
+	languageID string
+	// options are sent as the initializationOptions of the server
+	options map[string]any
+
+	mu     sync.Mutex
+	opened map[string]bool
+}
+
+// ServerFactory creates backends for language servers started with the command, e.g. clangd or pyright-langserver --stdio
+func ServerFactory(name, languageID string, command []string) Factory {
+	return func(ctx context.Context, root string) (Backend, error) {
+		if len(command) == 0 {
+			return nil, fmt.Errorf("missing command for language server: %s", name)
+		}
+		return NewSession(ctx, root, name, languageID, command[0], command[1:]...)
+	}
+}
+
+// NewSession starts the language server in root and performs the initialize handshake
+func NewSession(ctx context.Context, root, name, languageID, command string, args ...string) (*Session, error) {
+	return startSession(ctx, root, name, languageID, nil, command, args...)
+}
+
+// startSession starts the language server, initialized with the options
+func startSession(ctx context.Context, root, name, languageID string, options map[string]any, command string, args ...string) (*Session, error) {
+	conn, err := dial(root, command, args...)
+	if err != nil {
+		return nil, err
+	}
+	s := &Session{
+		conn:       conn,
+		name:       name,
+		root:       root,
+		languageID: languageID,
+		options:    options,
+		opened:     make(map[string]bool),
+	}
+	if err := s.initialize(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error initializing %s: %v", name, err)
+	}
+	return s, nil
+}
+
+func (s *Session) Name() string {
+	return s.name
+}
+
+func (s *Session) initialize(ctx context.Context) error {
+	params := map[string]any{
+		"processId":        os.Getpid(),
+		"rootUri":          URI(s.root),
+		"workspaceFolders": s.workspaceFolders(),
+		"capabilities": map[string]any{
+			"textDocument": map[string]any{
+				"documentSymbol": map[string]any{
+					"hierarchicalDocumentSymbolSupport": true,
+				},
+				"references":     map[string]any{},
+				"implementation": map[string]any{},
+			},
+		},
+	}
+	if s.options != nil {
+		params["initializationOptions"] = s.options
+	}
+	if err := s.conn.Call(ctx, "initialize", params, nil); err != nil {
+		return err
+	}
+	return s.conn.Notify("initialized", struct{}{})
+}
+
+// workspaceFolders are the root, or the modules below it for Go servers if the root has no go.work file
+// With a go.work file the server loads the modules of the workspace itself
+func (s *Session) workspaceFolders() []map[string]string {
+	folders := []map[string]string{{"uri": URI(s.root), "name": s.root}}
+	if s.languageID != "go" {
+		return folders
+	}
+	if _, err := os.Stat(filepath.Join(s.root, "go.work")); err == nil {
+		return folders
+	}
+	modules, err := Modules(s.root)
+	if err != nil || len(modules) < 2 {
+		return folders
+	}
+	folders = folders[:0]
+	for _, m := range modules {
+		folders = append(folders, map[string]string{"uri": URI(m.Dir), "name": m.Path})
+	}
+	return folders
+}
+
+// open sends the content of the file to the server the first time it is queried
+// Some servers only answer requests for opened documents
+func (s *Session) open(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.opened[path] {
+		return nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading file: %s, err: %v", path, err)
+	}
+	if err := s.conn.Notify("textDocument/didOpen", map[string]any{
+		"textDocument": textDocumentItem{
+			URI:        URI(path),
+			LanguageID: s.languageID,
+			Version:    1,
+			Text:       string(content),
+		},
+	}); err != nil {
+		return err
+	}
+	s.opened[path] = true
+	return nil
+}
+
+// Changed closes the file if it is open, so the next query opens its current content,
+// and tells the server that the file changed on disk or was removed
+func (s *Session) Changed(ctx context.Context, path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.opened[path] {
+		if err := s.conn.Notify("textDocument/didClose", map[string]any{
+			"textDocument": textDocumentIdentifier{URI: URI(path)},
+		}); err != nil {
+			return err
+		}
+		delete(s.opened, path)
+	}
+	event := fileEvent{URI: URI(path), Type: fileChanged}
+	if _, err := os.Stat(path); err != nil {
+		event.Type = fileDeleted
+	}
+	return s.conn.Notify("workspace/didChangeWatchedFiles", map[string]any{"changes": []fileEvent{event}})
+}
+
+// Symbols returns the symbols declared in the file
+// Servers without hierarchical symbol support answer with a flat list of symbol information, which is converted
+func (s *Session) Symbols(ctx context.Context, path string) ([]DocumentSymbol, error) {
+	if err := s.open(path); err != nil {
+		return nil, err
+	}
+	var raw []json.RawMessage
+	params := map[string]any{"textDocument": textDocumentIdentifier{URI: URI(path)}}
+	if err := s.conn.Call(ctx, "textDocument/documentSymbol", params, &raw); err != nil {
+		return nil, err
+	}
+	symbols := make([]DocumentSymbol, 0, len(raw))
+	for _, r := range raw {
+		var ds struct {
+			DocumentSymbol
+			Location *Location `json:"location"`
+		}
+		if err := json.Unmarshal(r, &ds); err != nil {
+			return nil, fmt.Errorf("error unmarshaling document symbol: %v", err)
+		}
+		if ds.Location != nil {
+			ds.Range = ds.Location.Range
+			ds.SelectionRange = ds.Location.Range
+		}
+		symbols = append(symbols, ds.DocumentSymbol)
+	}
+	return symbols, nil
+}
+
+// References returns the locations referencing the symbol at the given position, excluding its declaration
+func (s *Session) References(ctx context.Context, path string, pos Position) ([]Location, error) {
+	if err := s.open(path); err != nil {
+		return nil, err
+	}
+	var params referenceParams
+	params.TextDocument = textDocumentIdentifier{URI: URI(path)}
+	params.Position = pos
+	var locations []Location
+	if err := s.conn.Call(ctx, "textDocument/references", params, &locations); err != nil {
+		return nil, err
+	}
+	return locations, nil
+}
+
+func (s *Session) Implementations(ctx context.Context, path string, pos Position) ([]Location, error) {
+	if err := s.open(path); err != nil {
+		return nil, err
+	}
+	params := textDocumentPositionParams{
+		TextDocument: textDocumentIdentifier{URI: URI(path)},
+		Position:     pos,
+	}
+	var locations []Location
+	if err := s.conn.Call(ctx, "textDocument/implementation", params, &locations); err != nil {
+		return nil, err
+	}
+	return locations, nil
+}
+
+// Shutdown asks the server to shut down and waits for the process to exit
+func (s *Session) Shutdown(ctx context.Context) error {
+	if err := s.conn.Call(ctx, "shutdown", nil, nil); err != nil {
+		s.conn.Close()
+		return err
+	}
+	_ = s.conn.Notify("exit", nil)
+	return s.conn.Close()
+}
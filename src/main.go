@@ -1,12 +1,18 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"os"
 	"os/exec"
+	"os/signal"
+	"time"
 
 	"github.com/JoachimTislov/RefViz/internal"
+	"github.com/JoachimTislov/RefViz/lsp"
 	"github.com/JoachimTislov/RefViz/mappers"
 	"github.com/JoachimTislov/RefViz/ops"
 )
@@ -15,13 +21,24 @@ import (
 TODO: implement libraries which finds references for typescript
 */
 
-func init() {
-	if err := ops.LoadDefs(); err != nil {
-		log.Fatal(err)
+// errFound tells CI that -unused or -unreachable found symbols, RefViz exits with code 2
+var errFound = errors.New("found unused or unreachable symbols")
+
+func main() {
+	err := run()
+	// The language server is shared by all queries and is stopped when RefViz is done
+	shutdown()
+	if errors.Is(err, errFound) {
+		// 1 is used for errors, 2 tells CI the check found symbols
+		os.Exit(2)
+	} else if err != nil {
+		log.Println(err)
+		os.Exit(1)
 	}
 }
 
-func main() {
+// run performs the operations of the flags, the cache is saved and the backends are stopped after it returns
+func run() error {
 	graphviz := flag.String("graphviz", "", "generate graphviz file with the given map")
 	lm := flag.Bool("lm", false, "list maps")
 	ln := flag.Bool("ln", false, "list nodes")
@@ -34,35 +51,124 @@ func main() {
 	content := flag.String("content", "", "content to scan, file or folder")
 	display := flag.Bool("display", false, "display the map")
 	forceScan := flag.Bool("fs", false, "force scan, ignores cache")
+	gitDiff := flag.Bool("git", false, "only scan cached files changed since the commit of the last full scan")
 	forceUpdate := flag.Bool("fu", false, "force update map content")
 	ask := flag.Bool("a", false, "select content to add to map")
+	watch := flag.Bool("watch", false, "scan changed files, update the maps containing them and their graphviz files")
+	retryErrors := flag.Bool("retry-errors", false, "scan the failed files and symbols stored in the cache again")
+	jobs := flag.Int("j", 0, "number of jobs running at once, defaults to the number of CPUs")
+	gc := flag.Bool("gc", false, "remove the cache entries of deleted and excluded files")
+	query := flag.String("query", "", "query the cache: callers, callees or defs of -symbol")
+	symbol := flag.String("symbol", "", "symbol id, or regular expression matching symbol names, to query")
+	depth := flag.Int("depth", 1, "depth of transitive callers or callees, 0 for no limit")
+	format := flag.String("format", "text", "output of -query, -unused and -unreachable: text, json, lines (file:line:column) or sarif (reports only)")
+	unused := flag.Bool("unused", false, "report the scanned symbols without references, exits with code 2 if any are found")
+	unreachable := flag.Bool("unreachable", false, "report the symbols not reachable from main, init, tests, exported library symbols or the roots in the config, highlighted in the -m map if given, exits with code 2 if any are found")
+	kinds := flag.String("kind", "", "comma separated kinds reported by -unused and -unreachable, e.g. Function,Method (default all)")
+	visibility := flag.String("visibility", "", "visibility reported by -unused and -unreachable, exported or unexported (default both)")
+	testRefs := flag.Bool("test-refs", false, "count references from _test.go files as uses in -unused")
+	allowlist := flag.String("allowlist", "", "file with a regular expression per line, matching ids of symbols -unused and -unreachable do not report")
+	explainSkips := flag.Bool("explain", false, "log why paths are skipped by -scan and -add")
+	backend := flag.String("backend", "", "backend used to find symbols and references, gopls or native (default from config)")
+	root := flag.String("root", "", "project root, overrides the root in the config and the detected git, go.work or go.mod root")
+	storage := flag.String("storage", "", fmt.Sprintf("folder of the config, cache and maps, %q for the refViz folder of the project (default $%s, the storage in refViz/config.json, refViz if it exists, or the user cache directory)", internal.InRepo, internal.StorageEnv))
 	flag.Parse()
 
+	if err := ops.LoadDefs(*root, *storage); err != nil {
+		return err
+	}
+
+	if err := ops.SetBackend(*backend); err != nil {
+		return err
+	}
+	ops.SetJobs(*jobs)
+	ops.SetExplain(*explainSkips)
+
+	// Ctrl+C stops new jobs, the running ones finish or are cancelled before the cache is saved
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		// a second Ctrl+C exits immediately
+		stop()
+		log.Println("Interrupted, saving progress. Press Ctrl+C again to quit")
+	}()
+
 	// Determine if map operations are to be performed
-	ops.CheckMapOps(lm, ln, create, add, delete, mapName, nodeName, content, forceScan, forceUpdate, ask)
+	ops.CheckMapOps(ctx, lm, ln, create, add, delete, mapName, nodeName, content, forceScan, forceUpdate, ask)
 
 	if *scan {
-		if err := ops.Scan(content, forceScan, ask); err != nil {
-			log.Fatalf("Error scanning content: %v\n", err)
+		if err := ops.Scan(ctx, content, forceScan, ask, gitDiff); err != nil {
+			return fmt.Errorf("error scanning content: %v", err)
+		}
+	}
+	if *gc {
+		if err := ops.GC(); err != nil {
+			return fmt.Errorf("error collecting garbage: %v", err)
+		}
+	}
+	if *retryErrors {
+		if err := ops.RetryErrors(ctx); err != nil {
+			return fmt.Errorf("error retrying failed scans: %v", err)
+		}
+	}
+	if *query != "" {
+		if err := ops.Query(query, symbol, format, depth); err != nil {
+			return fmt.Errorf("error querying cache: %v", err)
+		}
+	}
+	if *unused {
+		n, err := ops.Unused(kinds, visibility, allowlist, format, testRefs)
+		if err != nil {
+			return fmt.Errorf("error reporting unused symbols: %v", err)
+		}
+		if n > 0 {
+			return errFound
+		}
+	}
+	if *unreachable {
+		n, err := ops.Unreachable(kinds, visibility, allowlist, format, mapName)
+		if err != nil {
+			return fmt.Errorf("error reporting unreachable symbols: %v", err)
+		}
+		// the map is displayed below instead of failing the check
+		if n > 0 && !*display {
+			return errFound
+		}
+	}
+	if *watch {
+		if err := ops.Watch(ctx, mappers.CreateGraphvizFile); err != nil {
+			return fmt.Errorf("error watching project: %v", err)
 		}
 	}
 	// Update the if graphviz flag is set or map name is provided and user wants to display the map
 	if *mapName != "" && *display {
 		graphviz = mapName
 	} else if *mapName == "" && *display {
-		log.Fatal("Please provide a map name to display")
+		return errors.New("please provide a map name to display")
 	}
 	if *graphviz != "" {
 		// Following can be written with any graphing library
 		// Currently, the graph is visualized with graphviz
 		// Extension: tintinweb.graphviz-interactive-preview, can display the graph in vscode
 		if err := mappers.CreateGraphvizFile(graphviz); err != nil {
-			log.Fatalf("error creating graphviz map: %v", err)
+			return fmt.Errorf("error creating graphviz map: %v", err)
 		}
 
 		cmd := exec.Command("xdot", internal.DotFilePath(graphviz))
 		if err := cmd.Start(); err != nil {
-			log.Fatalf("Please install xdot with: sudo apt-get install xdot, its used to display the graph")
+			return fmt.Errorf("please install xdot with: sudo apt-get install xdot, its used to display the graph: %v", err)
 		}
 	}
+	return nil
+}
+
+func shutdown() {
+	if err := ops.Close(); err != nil {
+		log.Printf("error saving cache: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := lsp.Shutdown(ctx); err != nil {
+		log.Printf("error shutting down language server: %v", err)
+	}
 }
@@ -3,6 +3,7 @@ package mappers
 import (
 	"fmt"
 	"html/template"
+	"math"
 	"os"
 	"strings"
 
@@ -49,6 +50,7 @@ func createTemplate(mapName *string) (*template.Template, error) {
 		"arr": func(els ...any) any { // https://dev.to/moniquelive/passing-multiple-arguments-to-golang-templates-16h8
 			return els
 		},
+		"penwidth": penwidth,
 		"debug": func(msg any) error {
 			fmt.Println(msg)
 			return nil
@@ -57,6 +59,11 @@ func createTemplate(mapName *string) (*template.Template, error) {
 	return template.New(*mapName).Funcs(funcMap).Parse(tmpl)
 }
 
+// penwidth grows logarithmically with the number of occurrences, so heavily used symbols stand out without dominating
+func penwidth(count int) string {
+	return fmt.Sprintf("%.1f", 1+math.Log2(float64(count)))
+}
+
 // https://golang.org/pkg/text/template/
 // recursive template with nested definitions
 // Whitespace control: https://golang.org/pkg/text/template/#hdr-Text_and_spaces, its a bit tricky
@@ -68,10 +75,13 @@ const tmpl = `digraph {{.Name}} {
 	}
 {{- end}}
 	{{- define "refs"}}
-		{{- $symbolRefs := index . 0}}
-		{{- $folderName := index . 1}}
-		{{- range $symbolRef := $symbolRefs}}
-				{{$folderName}}_{{trimSpace $symbolRef.Definition.Name}} -> {{$symbolRef.Ref.FolderName}}_{{trimSpace $symbolRef.Ref.MethodName}};
+		{{- range $symbolRef := .}}
+			{{- if eq $symbolRef.Relation "implements"}}
+				"{{$symbolRef.Ref.SymbolID}}" -> "{{$symbolRef.Definition.ID}}" [style = dashed; label = "implements";];
+			{{- else}}
+				"{{$symbolRef.Definition.ID}}" -> "{{$symbolRef.Ref.SymbolID}}"
+				{{- if gt $symbolRef.Count 1}} [penwidth = {{penwidth $symbolRef.Count}}; label = "{{$symbolRef.Count}}";]{{end}};
+			{{- end}}
 		{{- end}}
 	{{- end}}
 {{- define "subgraph" -}}
@@ -82,7 +92,6 @@ const tmpl = `digraph {{.Name}} {
 	{{- end}}
 {{- end}}
 {{- define "graph" -}}
-		{{- $folderName := .FolderName}} {{- /* to avoid issues in files loop */ -}}
 		{{- if .Files}}		
 		subgraph cluster_{{replace .FolderName "-" "_"}} {
 			label = "{{.FolderName}} (folder)";
@@ -93,11 +102,11 @@ const tmpl = `digraph {{.Name}} {
 				labelloc="t";
 				rankdir=TB;
 				{{- range $symbol := $file.Symbols}}
-				{{$folderName}}_{{trimSpace $symbol.Name}} [label = "{{trimSpace $symbol.Name}}, {{$symbol.Kind}}";shape = box;];
-					{{- template "refs" (arr $symbol.Refs $folderName) -}}
+				"{{$symbol.ID}}" [label = "{{trimSpace $symbol.Name}}, {{$symbol.Kind}}";shape = box;{{if $symbol.Highlight}}style = filled;fillcolor = "#f4cccc";{{end}}];
+					{{- template "refs" $symbol.Refs -}}
 				{{- end}}
 			}
-			{{- template "refs" (arr $file.Refs $folderName) -}}
+			{{- template "refs" $file.Refs -}}
 			{{- end}}
 
 			{{- if .SubFolders }}
@@ -105,7 +114,7 @@ const tmpl = `digraph {{.Name}} {
 			{{- end}}
 		}
 		{{- if .Refs }}
-			{{- template "refs" (arr .Refs .FolderName) -}}
+			{{- template "refs" .Refs -}}
 		{{- end}}
 		{{- else}}
 			{{- if .SubFolders }}
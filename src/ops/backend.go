@@ -0,0 +1,95 @@
+package ops
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"sync"
+
+	"github.com/JoachimTislov/RefViz/internal"
+	"github.com/JoachimTislov/RefViz/lsp"
+)
+
+const (
+	goplsBackend  = "gopls"
+	nativeBackend = "native"
+	goExt         = ".go"
+)
+
+var (
+	backendFlag string
+	fallback    sync.Once
+)
+
+// SetBackend overrides the Go backend from the configurations
+func SetBackend(name string) error {
+	if name != "" && name != goplsBackend && name != nativeBackend {
+		return fmt.Errorf("unknown backend: %s, expected %s or %s", name, goplsBackend, nativeBackend)
+	}
+	backendFlag = name
+	return lsp.Use(goExt, goBackendName())
+}
+
+// registerBackends selects the Go backend, the language servers of the config are registered when it is loaded
+// Included extensions without a backend are reported, since their files can not be scanned
+func registerBackends() error {
+	if err := lsp.Use(goExt, goBackendName()); err != nil {
+		return err
+	}
+	for ext := range config.InExt {
+		if !lsp.Supports(ext) {
+			log.Printf("No backend registered for %s files, add a language server to the configurations\n", ext)
+		}
+	}
+	return nil
+}
+
+// registerLanguageServers registers the language servers of the config, their markers are used to detect the project root
+func registerLanguageServers() {
+	for _, s := range config.LanguageServers {
+		lsp.Register(s.Name, s.Extensions, s.Markers, lsp.ServerFactory(s.Name, s.LanguageID, s.Command))
+	}
+}
+
+// serverMarkers reports whether the language servers of the config have root markers
+func serverMarkers() bool {
+	for _, s := range config.LanguageServers {
+		if len(s.Markers) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// goBackendName returns the backend to use for Go files, the flag takes precedence over the configurations
+// Falls back to the native backend if gopls is not installed
+func goBackendName() string {
+	name := backendFlag
+	if name == "" {
+		name = config.Backend
+	}
+	if name == nativeBackend {
+		return nativeBackend
+	}
+	if _, err := exec.LookPath(goplsBackend); err != nil {
+		fallback.Do(func() {
+			log.Printf("gopls is not installed, using the %s backend\n", nativeBackend)
+		})
+		return nativeBackend
+	}
+	return goplsBackend
+}
+
+// backendName returns the name of the backend handling the file, used when logging failed queries
+func backendName(path string) string {
+	if name, ok := lsp.BackendName(filepath.Ext(path)); ok {
+		return name
+	}
+	return "unknown"
+}
+
+func getBackend(ctx context.Context, path string) (lsp.Backend, error) {
+	return lsp.For(ctx, internal.ProjectPath(), path)
+}
@@ -14,12 +14,20 @@ func cacheEntry(cacheEntry *types.CacheEntry, path string) error {
 		return fmt.Errorf("error getting relative path: %s, err: %v", path, err)
 	}
 	cache.AddEntry(relPath, cacheEntry)
-	// updates the cache file
-	// writefile creates the cache file if it does not exist
-	cache.Mu.Lock()
-	defer cache.Mu.Unlock()
-	if err := marshalAndWriteToFile(cache, internal.CachePath()); err != nil {
-		return err
+	cacheStore.Update(relPath)
+	return cacheStore.Save()
+}
+
+// saveCache writes the buffered updates of the cache
+func saveCache() error {
+	return cacheStore.Flush()
+}
+
+// Close writes the buffered updates of the cache and releases its lock
+func Close() error {
+	// the cache is not loaded if loading the project failed
+	if cacheStore == nil {
+		return nil
 	}
-	return nil
+	return cacheStore.Close()
 }
@@ -1,15 +1,39 @@
 package ops
 
-import "github.com/JoachimTislov/RefViz/types"
+import (
+	"time"
+
+	"github.com/JoachimTislov/RefViz/internal"
+	"github.com/JoachimTislov/RefViz/store"
+	"github.com/JoachimTislov/RefViz/types"
+)
 
 const (
-	function = "Function"
 	yes      = "y"
 	Entities = "map, node"
 	method   = "Method"
+	function = "Function"
+	iface    = "Interface"
+
+	// queryTimeout limits how long a single symbols or references query may take
+	queryTimeout = 2 * time.Minute
+	// progressInterval is the number of jobs between progress logs
+	progressInterval = 100
 )
 
 var (
 	config = types.NewConfig()
 	cache  = types.NewCache()
+	// cacheStore persists the cache, created when the config is loaded
+	cacheStore *store.Store
+	// refSymbols are the symbols of the files references are located in, reset by each scan
+	refSymbols = newSymbolCache()
+	// symbolFilter skips the symbols excluded by the config, see loadSymbolFilter
+	symbolFilter *types.SymbolFilter
+	// ignore matches the paths excluded by the config and the ignore files, see loadIgnore
+	ignore *internal.Ignore
+	// explain logs why paths are skipped, see SetExplain
+	explain bool
+	// jobs is the number of jobs running at once, see SetJobs
+	jobs int
 )
@@ -0,0 +1,72 @@
+package ops
+
+import (
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/JoachimTislov/RefViz/internal"
+)
+
+// GC removes the cache entries of deleted and excluded files, and reports what was removed
+func GC() error {
+	if !collect() {
+		log.Println("Nothing to remove from the cache")
+	}
+	return saveCache()
+}
+
+// collect removes the entries of files which no longer exist or pass the filters, and the references into them
+// Returns false if nothing was removed
+func collect() bool {
+	relPaths := make(map[string]bool)
+	cache.Mu.RLock()
+	for relPath := range cache.Entries {
+		path := filepath.Join(internal.ProjectPath(), relPath)
+		if !internal.Exists(path) || !isValid(false, path) {
+			relPaths[relPath] = true
+		}
+	}
+	for relPath := range cache.Unfinished {
+		if !internal.Exists(filepath.Join(internal.ProjectPath(), relPath)) {
+			relPaths[relPath] = true
+		}
+	}
+	cache.Mu.RUnlock()
+	if len(relPaths) == 0 {
+		return false
+	}
+
+	refs, stale := cache.Remove(relPaths)
+	// failed commands of the removed files can not be retried
+	var errors int
+	for _, command := range cache.TakeErrors() {
+		if removedCommand(command, relPaths) {
+			errors++
+			continue
+		}
+		cache.LogError(command)
+	}
+	cacheStore.UpdateAll()
+
+	log.Printf("Removed %d cache entries of deleted or excluded files:\n", len(relPaths))
+	for relPath := range relPaths {
+		log.Printf("\t%s\n", relPath)
+	}
+	log.Printf("Removed %d references into them and %d failed commands, %d symbols lost all references and are scanned again\n", refs, errors, stale)
+	return true
+}
+
+// removedCommand checks if the location of the command is in one of the files
+func removedCommand(command string, relPaths map[string]bool) bool {
+	parts := strings.SplitN(command, " ", 3)
+	if len(parts) != 3 {
+		return false
+	}
+	for path := range relPaths {
+		if parts[2] == path || strings.HasPrefix(parts[2], path+":") {
+			return true
+		}
+	}
+	return false
+}
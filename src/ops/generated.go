@@ -0,0 +1,88 @@
+package ops
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/JoachimTislov/RefViz/internal"
+	"github.com/JoachimTislov/RefViz/lsp"
+	"github.com/JoachimTislov/RefViz/types"
+)
+
+// How generated files are handled, see types.Config.Generated
+const (
+	generatedSkip     = "skip"
+	generatedCollapse = "collapse"
+	generatedInclude  = "include"
+
+	// fileKind is the kind of the symbol a collapsed file is shown as
+	fileKind = "File"
+)
+
+var (
+	generatedMu sync.Mutex
+	// generatedFiles caches which files are generated, keyed by absolute path
+	generatedFiles = make(map[string]bool)
+)
+
+// loadBuild checks the generated files setting and sets the target of the build constraints
+func loadBuild() error {
+	switch config.Generated {
+	case "", generatedSkip, generatedCollapse, generatedInclude:
+	default:
+		return fmt.Errorf("unknown generated: %s, expected %s, %s or %s", config.Generated, generatedSkip, generatedCollapse, generatedInclude)
+	}
+	lsp.SetBuildContext(config.Build.GOOS, config.Build.GOARCH, config.Build.Tags)
+	return nil
+}
+
+// isGenerated checks if the file has the comment marking generated code, files which can not be read are not
+func isGenerated(path string) bool {
+	generatedMu.Lock()
+	defer generatedMu.Unlock()
+	generated, ok := generatedFiles[path]
+	if !ok {
+		generated, _ = internal.IsGenerated(path)
+		generatedFiles[path] = generated
+	}
+	return generated
+}
+
+// forgetGenerated drops the cached check of the changed file, it may have gained or lost the comment
+func forgetGenerated(path string) {
+	generatedMu.Lock()
+	defer generatedMu.Unlock()
+	delete(generatedFiles, path)
+}
+
+// collapsed checks if the file is generated and shown as one symbol in maps
+func collapsed(path string) bool {
+	return config.Generated == generatedCollapse && isGenerated(path)
+}
+
+// collapsedID identifies the symbol a collapsed file is shown as
+func collapsedID(relPath string) string {
+	return types.SymbolID(filepath.ToSlash(filepath.Dir(relPath)), "", filepath.Base(relPath), fileKind)
+}
+
+// collapse returns one symbol for the file, with the references of all its symbols
+// References from the file to itself are left out
+func collapse(relPath string, symbols map[string]*types.Symbol) map[string]*types.Symbol {
+	id := collapsedID(relPath)
+	file := &types.Symbol{
+		ID:       id,
+		Name:     filepath.Base(relPath),
+		Kind:     fileKind,
+		FilePath: relPath,
+		Refs:     make(map[string]*types.Ref),
+	}
+	for _, s := range symbols {
+		for key, ref := range s.Refs {
+			if ref.SymbolID != id {
+				file.Refs[key] = ref
+			}
+		}
+	}
+	return map[string]*types.Symbol{id: file}
+}
@@ -1,26 +1,27 @@
 package ops
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
-	"strings"
+	"sync/atomic"
 
 	"github.com/JoachimTislov/RefViz/internal"
 	"github.com/JoachimTislov/RefViz/routines"
 	"github.com/JoachimTislov/RefViz/types"
 )
 
-// GetFile reads the content of the file and unmarshals it into the given variable
-func getFile(filePath string, v any) error {
+// GetFile reads the content of the file, migrates it to the current version of the schema and unmarshals it into the given variable
+// Returns a types.SchemaError if it can not be migrated
+func getFile(filePath string, schema types.Schema, v any) error {
 	bytes, err := os.ReadFile(filePath)
 	if err != nil {
 		return fmt.Errorf("get content from cache error: %s", err)
 	}
-	if err := json.Unmarshal(bytes, &v); err != nil {
-		return fmt.Errorf("unmarshaling error: %s", err)
+	if _, err := types.Decode(schema, bytes, v); err != nil {
+		return fmt.Errorf("%s: %w", filePath, err)
 	}
 	return nil
 }
@@ -33,47 +34,86 @@ func getFolderPathAndFileName(absPath string) (string, string, error) {
 	return filepath.Dir(relPath), filepath.Base(relPath), nil
 }
 
-func getContent(path string, scanAgain bool, everythingIsUpToDate *bool) func() error {
+// getContent scans the symbols of the file and submits the jobs finding their references
+// The entry is cached, and the file finished, when the references of every symbol are found
+func getContent(ctx context.Context, scheduler *routines.Scheduler, path string, scanAgain bool, everythingIsUpToDate *atomic.Bool) func() error {
 	return func() error {
-		c, scannedForSymbols, err := getSymbols(path, scanAgain)
+		relPath, err := filepath.Rel(internal.ProjectPath(), path)
+		if err != nil {
+			return fmt.Errorf("error getting relative path: %s, err: %v", path, err)
+		}
+		c, scannedForSymbols, err := getSymbols(ctx, path, scanAgain)
 		if err != nil {
 			return fmt.Errorf("error getting symbols: %s, err: %v", path, err)
 		}
+		if c == nil {
+			// the error is logged in the cache
+			cache.FinishFile(relPath)
+			return nil
+		}
 
 		var scannedForRefs bool
 		var jobs []func() error
+		// the symbols are in the cache, which may be flushed by the jobs of other files
+		cache.Mu.Lock()
 		for _, s := range c.Symbols {
-			if !strings.HasPrefix(s.Name, "Test") && s.Name != "init" && s.Name != "main" && (len(s.Refs) == 0 && !s.ZeroRefs || scanAgain) {
+			if symbolFilter.Skip(relPath, s) {
+				s.Stale = false
+				continue
+			}
+			if !s.IsScanned() || scanAgain || s.Stale {
 				scannedForRefs = true
-				if s.Refs == nil {
+				// references found earlier may have moved or been removed
+				if s.Refs == nil || scanAgain || s.Stale {
 					s.Refs = make(map[string]*types.Ref)
+					s.ZeroRefs = false
+					s.Scanned = false
 				}
-				jobs = append(jobs, getRefs(path, s, &s.Refs))
+				s.Stale = false
+				jobs = append(jobs, getRefs(ctx, path, s, &s.Refs))
 			}
 		}
-		var workers int
-		l := len(jobs)
-		if l < 3 {
-			workers = l
-		}
-		routines.StartWork(workers, jobs)
-
+		cache.Mu.Unlock()
 		if scannedForSymbols {
 			if scannedForRefs {
 				log.Println("Found content for path: ", path)
 				if everythingIsUpToDate != nil {
-					*everythingIsUpToDate = false
+					everythingIsUpToDate.Store(false)
 				}
 			} else {
 				log.Println("No references to scan for in path: ", path)
 			}
 		}
-		if scannedForRefs {
-			log.Printf("Final caching for path: %s\n", path)
+		if !scannedForRefs {
+			cache.FinishFile(relPath)
+			return nil
+		}
 
-			if err := cacheEntry(c, path); err != nil {
-				return fmt.Errorf("error caching symbols: %s, err: %v", path, err)
-			}
+		// the last reference job caches the entry, jobs dropped by an interrupted scan leave the file unfinished
+		// and so do failed jobs, the first error of the jobs is kept for the last one
+		remaining := int32(len(jobs))
+		var failed atomic.Pointer[error]
+		for _, job := range jobs {
+			scheduler.Submit(routines.Low, path, func() error {
+				err := job()
+				if err != nil {
+					failed.CompareAndSwap(nil, &err)
+				}
+				if atomic.AddInt32(&remaining, -1) > 0 {
+					return err
+				}
+				log.Printf("Final caching for path: %s\n", path)
+
+				if err := cacheEntry(c, path); err != nil {
+					return fmt.Errorf("error caching symbols: %s, err: %v", path, err)
+				}
+				if first := failed.Load(); first != nil {
+					log.Printf("Not all references found for path: %s, err: %v\n", path, *first)
+					return err
+				}
+				cache.FinishFile(relPath)
+				return nil
+			})
 		}
 		return nil
 	}
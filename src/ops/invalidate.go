@@ -0,0 +1,145 @@
+package ops
+
+import (
+	"context"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/JoachimTislov/RefViz/internal"
+	"github.com/JoachimTislov/RefViz/lsp"
+)
+
+var identifier = regexp.MustCompile(`[\p{L}_][\p{L}\p{N}_]*`)
+
+// invalidate marks the symbols of other files affected by the changed files as stale
+// The references of stale symbols are scanned again, even if the file of the symbol is unchanged
+func invalidate(paths []string) error {
+	// files missing in the cache are only new if they were modified after the cache was written,
+	// otherwise the cached references already include them
+	var cachedAt int64
+	if f, err := os.Stat(internal.CachePath()); err == nil {
+		cachedAt = f.ModTime().UnixNano()
+	}
+	var n int
+	// the modules are only looked up if a Go file changed
+	var modules []lsp.Module
+	var modulesLoaded bool
+	for _, path := range paths {
+		f, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("error getting file info: %s, err: %v", path, err)
+		}
+		entry, err := checkCache(path)
+		if err != nil {
+			return fmt.Errorf("error checking cache: %s, err: %v", path, err)
+		}
+		if entry.Hash == "" && f.ModTime().UnixNano() < cachedAt {
+			continue
+		}
+		changed, _, err := hasChanged(entry, path, f.ModTime().UnixNano())
+		if err != nil {
+			return err
+		}
+		if !changed {
+			continue
+		}
+		names, err := identifiers(path)
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(internal.ProjectPath(), path)
+		if err != nil {
+			return fmt.Errorf("error getting relative path: %s, err: %v", path, err)
+		}
+		var packages map[string]bool
+		if filepath.Ext(path) == ".go" {
+			if !modulesLoaded {
+				if modules, err = lsp.Modules(internal.ProjectPath()); err != nil {
+					return fmt.Errorf("error getting modules: %v", err)
+				}
+				modulesLoaded = true
+			}
+			packages = reachablePackages(path, modules)
+		}
+		n += cache.Invalidate(relPath, names, packages)
+	}
+	if n == 0 {
+		return nil
+	}
+	log.Printf("Marked %d symbols in other files as stale\n", n)
+	cacheStore.UpdateAll()
+	return saveCache()
+}
+
+// identifiers returns the names occurring in the file, a superset of the symbols it references
+func identifiers(path string) (map[string]bool, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %s, err: %v", path, err)
+	}
+	names := make(map[string]bool)
+	for _, name := range identifier.FindAll(content, -1) {
+		names[string(name)] = true
+	}
+	return names, nil
+}
+
+// reachablePackages returns the directories, relative to the project, of the package of the Go file and the project packages it imports
+// The symbols of other packages can not be used by name in the file
+// Returns nil if the imports can not be parsed, then names match the symbols of every package
+func reachablePackages(path string, modules []lsp.Module) map[string]bool {
+	f, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.ImportsOnly)
+	if err != nil {
+		return nil
+	}
+	packages := map[string]bool{internal.ProjectRel(filepath.Dir(path)): true}
+	for _, spec := range f.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		if dir, ok := packageDir(importPath, modules); ok {
+			packages[internal.ProjectRel(dir)] = true
+		}
+	}
+	return packages
+}
+
+// packageDir returns the directory of the import path, in the module with the longest matching path
+func packageDir(importPath string, modules []lsp.Module) (string, bool) {
+	var module *lsp.Module
+	for i, m := range modules {
+		if (importPath == m.Path || strings.HasPrefix(importPath, m.Path+"/")) && (module == nil || len(m.Path) > len(module.Path)) {
+			module = &modules[i]
+		}
+	}
+	if module == nil {
+		return "", false
+	}
+	return filepath.Join(module.Dir, filepath.FromSlash(strings.TrimPrefix(importPath, module.Path))), true
+}
+
+// scanStale scans the references of the stale symbols left after scanning the content
+func scanStale(ctx context.Context, everythingIsUpToDate *atomic.Bool) error {
+	var paths []string
+	for _, relPath := range cache.StaleEntries() {
+		path := filepath.Join(internal.ProjectPath(), relPath)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	log.Printf("Scanning stale references in %d files\n", len(paths))
+	return scanFiles(ctx, paths, false, everythingIsUpToDate)
+}
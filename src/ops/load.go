@@ -1,46 +1,134 @@
 package ops
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/JoachimTislov/RefViz/internal"
+	"github.com/JoachimTislov/RefViz/lsp"
+	"github.com/JoachimTislov/RefViz/store"
+	"github.com/JoachimTislov/RefViz/types"
 )
 
-func LoadDefs() error {
-	if err := loadRootPath(); err != nil {
+// LoadDefs loads the project, root overrides the detected project root and storage the folder of the config, cache and maps if they are not empty
+// The root is detected with the markers of the built-in backends, and again with the markers of the language servers in the config
+func LoadDefs(root, storage string) error {
+	if err := loadRootPath(root); err != nil {
 		return fmt.Errorf("error loading root path: %v", err)
 	}
+	if err := loadStorage(storage); err != nil {
+		return fmt.Errorf("error loading storage folder: %v", err)
+	}
 	if err := initFolder(); err != nil {
 		return fmt.Errorf("error initializing project folder: %v", err)
 	}
 	if err := loadConfig(); err != nil {
 		return fmt.Errorf("error loading configurations: %v", err)
 	}
+	registerLanguageServers()
+	if root == "" && config.Root != "" {
+		if err := loadConfigRoot(); err != nil {
+			return fmt.Errorf("error loading root path from config: %v", err)
+		}
+	} else if root == "" && serverMarkers() {
+		// the config, cache and maps stay in the storage folder of the root detected with the built-in markers
+		if err := loadRootPath(""); err != nil {
+			return fmt.Errorf("error loading root path with the markers of the language servers: %v", err)
+		}
+	}
+	loadIgnore()
+	if err := loadBuild(); err != nil {
+		return fmt.Errorf("error loading build settings: %v", err)
+	}
+	if err := loadSymbolFilter(); err != nil {
+		return fmt.Errorf("error loading symbol rules: %v", err)
+	}
 	if err := loadCache(); err != nil {
 		return fmt.Errorf("error loading cache: %v", err)
 	}
+	if err := registerBackends(); err != nil {
+		return fmt.Errorf("error registering backends: %v", err)
+	}
 	return nil
 }
 
-// loadRootPath loads the root path of the project and sets it
-func loadRootPath() error {
-	root, err := internal.GetProjectRoot()
+// loadRootPath sets the root path of the project, the given root or the detected one if it is empty
+func loadRootPath(root string) error {
+	if root == "" {
+		detected, err := internal.GetProjectRoot(lsp.Markers())
+		if err != nil {
+			return err
+		}
+		root = detected
+	}
+	root, err := internal.GetAbsPath(root)
 	if err != nil {
 		return err
 	}
+	if f, err := os.Stat(root); err != nil || !f.IsDir() {
+		return fmt.Errorf("root is not a directory: %s", root)
+	}
 	if err := internal.SetProjectPath(root); err != nil {
 		return err
 	}
 	return nil
 }
 
-// initFolder initializes the project folder if it does not exist
+// loadConfigRoot moves the project root to the root in the config
+// The config, cache and maps stay in the storage folder of the detected root
+func loadConfigRoot() error {
+	return loadRootPath(internal.ProjectAbs(config.Root))
+}
+
+// loadStorage sets the folder of the config, cache and maps
+// The flag is used first, then the environment variable, the storage key of the config in the refViz folder of the project,
+// and the refViz folder itself if it exists. Otherwise the files are kept outside of the project, in the user cache directory
+func loadStorage(storage string) error {
+	// the flag and environment variable are relative to the working directory
+	base, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("error getting current working directory: %v", err)
+	}
+	if storage == "" {
+		storage = os.Getenv(internal.StorageEnv)
+	}
+	if storage == "" {
+		storage, base = repoStorage()
+	}
+	path, err := internal.ResolveStorage(storage, base)
+	if err != nil {
+		return err
+	}
+	internal.SetStoragePath(path)
+	return nil
+}
+
+// repoStorage returns the storage of the config in the refViz folder of the project, relative to the project root
+// Returns InRepo if the config does not set it, and an empty string if the project has no refViz folder
+// The config stays in the project if it moves the cache and maps to another folder
+func repoStorage() (string, string) {
+	repo := internal.RepoStoragePath()
+	if !internal.Exists(repo) {
+		return "", ""
+	}
+	repoConfig := filepath.Join(repo, "config.json")
+	c := types.NewConfig()
+	// an invalid config is reported when it is loaded
+	if !internal.Exists(repoConfig) || getFile(repoConfig, types.ConfigSchema, c) != nil || c.Storage == "" || c.Storage == internal.InRepo {
+		return internal.InRepo, ""
+	}
+	internal.SetConfigPath(repoConfig)
+	return c.Storage, internal.ProjectPath()
+}
+
+// initFolder initializes the storage folder if it does not exist
 func initFolder() error {
 	folderPaths := []string{internal.GetTempFolderPath(), internal.MapPath(), internal.GraphvizPath()}
 	for _, p := range folderPaths {
 		if !internal.Exists(p) {
-			if err := os.Mkdir(p, 0755); err != nil {
+			if err := os.MkdirAll(p, 0755); err != nil {
 				return fmt.Errorf("error creating project folder: %v", err)
 			}
 		}
@@ -51,27 +139,48 @@ func initFolder() error {
 // loadConfig creates default config file if it does not exist
 // If the file does exist it reads the file and unmarshals it into the config variable
 func loadConfig() error {
-	if err := loadFile(internal.ConfigPath(), config); err != nil {
-		return fmt.Errorf("error loading configurations: %v", err)
+	if err := loadFile(internal.ConfigPath(), types.ConfigSchema, config); err != nil {
+		var serr *types.SchemaError
+		if !errors.As(err, &serr) || !confirm(fmt.Sprintf("The config can not be read, %v. It will be replaced with the default config", err)) {
+			return fmt.Errorf("error loading configurations: %v", err)
+		}
+		config = types.NewConfig()
+		return save()
 	}
 	return nil
 }
 
+// loadSymbolFilter compiles the symbol rules of the config
+func loadSymbolFilter() error {
+	f, err := types.NewSymbolFilter(config.Symbols)
+	if err != nil {
+		return err
+	}
+	symbolFilter = f
+	return nil
+}
+
+// loadCache reads the cache with the store configured in the config
 func loadCache() error {
-	if err := loadFile(internal.CachePath(), cache); err != nil {
-		return fmt.Errorf("error loading cache: %v", err)
+	cacheStore = store.New(internal.CachePath(), config.ShardCache, cache)
+	if err := cacheStore.Load(); err != nil {
+		var serr *types.SchemaError
+		if !errors.As(err, &serr) || !confirm(fmt.Sprintf("The cache can not be read, %v. It will be rebuilt by the next scan", err)) {
+			return err
+		}
+		return cacheStore.Reset()
 	}
 	return nil
 }
 
-func loadFile(path string, v any) error {
+func loadFile(path string, schema types.Schema, v any) error {
 	if !internal.Exists(path) {
 		if err := marshalAndWriteToFile(v, path); err != nil {
 			return fmt.Errorf("error creating config file: %v", err)
 		}
 	} else {
-		if err := getFile(path, v); err != nil {
-			return fmt.Errorf("error getting config file: %v", err)
+		if err := getFile(path, schema, v); err != nil {
+			return fmt.Errorf("error getting config file: %w", err)
 		}
 	}
 	return nil
@@ -1,6 +1,8 @@
 package ops
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log"
@@ -8,19 +10,20 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 
 	"github.com/JoachimTislov/RefViz/internal"
 	"github.com/JoachimTislov/RefViz/types"
 )
 
-func CheckMapOps(lm, ln, create, add, delete *bool, mapName *string, nodeName *string, content *string, forceScan, forceUpdate, ask *bool) {
+func CheckMapOps(ctx context.Context, lm, ln, create, add, delete *bool, mapName *string, nodeName *string, content *string, forceScan, forceUpdate, ask *bool) {
 
 	operations := types.Operation{
 		{Condition: *lm, Action: listMaps, Msg: "error listing maps"},
 		{Condition: *ln, Action: func() error { return listNodes(mapName) }, Msg: "error listing nodes"},
 		{Condition: *create, Action: func() error { return createMap(mapName) }, Msg: "error creating map"},
 		{Condition: *delete, Action: func() error { return deleteMap(mapName) }, Msg: "error deleting map"},
-		{Condition: *add, Action: func() error { return addContentToMap(mapName, content, nodeName, forceScan, forceUpdate, ask) }, Msg: "error adding content to map"},
+		{Condition: *add, Action: func() error { return addContentToMap(ctx, mapName, content, nodeName, forceScan, forceUpdate, ask) }, Msg: "error adding content to map"},
 		{Condition: *nodeName != "" && !*add, Action: func() error { return addNodeToMap(mapName, nodeName) }, Msg: "error adding node to map"},
 	}
 
@@ -57,7 +60,7 @@ func createMap(name *string) error {
 	return nil
 }
 
-func addContentToMap(mapName, content, nodeName *string, forceScan, forceUpdate, ask *bool) error {
+func addContentToMap(ctx context.Context, mapName, content, nodeName *string, forceScan, forceUpdate, ask *bool) error {
 
 	if *mapName == "" || *content == "" {
 		log.Fatal("Please provide a map name and content to add")
@@ -82,7 +85,7 @@ func addContentToMap(mapName, content, nodeName *string, forceScan, forceUpdate,
 	}
 
 	for _, p := range paths {
-		if err := addPath(p, node.RootFolder, forceScan, forceUpdate); err != nil {
+		if err := addPath(ctx, p, node.RootFolder, forceScan, forceUpdate); err != nil {
 			return fmt.Errorf("error adding path: %v", err)
 		}
 	}
@@ -95,10 +98,13 @@ func addContentToMap(mapName, content, nodeName *string, forceScan, forceUpdate,
 	if err := marshalAndWriteToFile(rMap, internal.GetMapPath(rMap.Name)); err != nil {
 		return fmt.Errorf("error writing to file: %v", err)
 	}
-	return nil
+	if err := saveCache(); err != nil {
+		return fmt.Errorf("error saving cache: %v", err)
+	}
+	return report()
 }
 
-func addPath(p string, rootFolder *types.Folder, forceScan, forceUpdate *bool) error {
+func addPath(ctx context.Context, p string, rootFolder *types.Folder, forceScan, forceUpdate *bool) error {
 	e, err := os.Stat(p)
 	if err != nil {
 		return fmt.Errorf("error analyzing path: %s, err: %v", p, err)
@@ -113,8 +119,13 @@ func addPath(p string, rootFolder *types.Folder, forceScan, forceUpdate *bool) e
 		subPaths = append(subPaths, p)
 	}
 
+	var everythingIsUpToDate atomic.Bool
+	everythingIsUpToDate.Store(true)
+	if err := scanFiles(ctx, subPaths, *forceScan, &everythingIsUpToDate); err != nil {
+		return checkpoint(ctx, fmt.Errorf("error scanning files: %v", err))
+	}
 	for _, p := range subPaths {
-		if err := addFileToFolder(p, rootFolder, forceScan, forceUpdate); err != nil {
+		if err := addFileToFolder(ctx, p, rootFolder, forceUpdate); err != nil {
 			return fmt.Errorf("error adding file to folder: %v", err)
 		}
 	}
@@ -126,7 +137,13 @@ func retrieveContentInDir(p string, paths *[]string) error {
 		if err != nil {
 			return fmt.Errorf("error walking through directory: %v", err)
 		}
-		if !d.IsDir() {
+		if d.IsDir() {
+			if path != p && skip(true, path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !skip(false, path) {
 			*paths = append(*paths, path)
 		}
 		return nil
@@ -157,20 +174,21 @@ func determineNodeName(nodeName *string, nodes map[string]*types.Node, mapName *
 	return nil
 }
 
-func addFileToFolder(absPath string, folder *types.Folder, forceScan, forceUpdate *bool) error {
+// addFileToFolder adds the symbols of the scanned file to the folder
+func addFileToFolder(ctx context.Context, absPath string, folder *types.Folder, forceUpdate *bool) error {
 
 	folder, err := folder.GetRelatedFolder(absPath, internal.ProjectPath())
 	if err != nil {
 		return fmt.Errorf("error updating to related folder: %v", err)
 	}
-	// honestly, just stupid, but it works
-	// result of making a function specific for one case....
-	getContent(absPath, *forceScan, nil)()
-
-	cacheEntry, _, err := getSymbols(absPath, false)
+	cacheEntry, _, err := getSymbols(ctx, absPath, false)
 	if err != nil {
 		return fmt.Errorf("error getting symbols: %v", err)
 	}
+	if cacheEntry == nil {
+		// the failure is in the scan report
+		return nil
+	}
 	////
 
 	folderPath, fileName, err := getFolderPathAndFileName(absPath)
@@ -178,12 +196,49 @@ func addFileToFolder(absPath string, folder *types.Folder, forceScan, forceUpdat
 		return fmt.Errorf("error getting folder path and file name: %v", err)
 	}
 	file := folder.GetFile(&fileName, &folderPath)
-	fullFolderPath := filepath.Join(internal.ProjectPath(), folderPath)
-	file.AddSymbols(&folder.Refs, &cacheEntry.Symbols, &fullFolderPath, &fileName, forceUpdate)
+	file.Added = true
+	relPath := filepath.Join(folderPath, fileName)
+	symbols := filterSymbols(relPath, cacheEntry.Symbols)
+	if collapsed(absPath) {
+		symbols = collapse(relPath, symbols)
+	}
+	file.AddSymbols(&folder.Refs, &symbols, &folderPath, &fileName, forceUpdate)
 	folder.AddFile(file, forceUpdate)
 	return nil
 }
 
+// filterSymbols returns copies of the symbols not skipped by the symbol rules
+// The rules apply to the added symbols, references from skipped symbols such as main are kept
+func filterSymbols(relPath string, symbols map[string]*types.Symbol) map[string]*types.Symbol {
+	filtered := make(map[string]*types.Symbol)
+	for id, s := range symbols {
+		if symbolFilter.Skip(relPath, s) {
+			continue
+		}
+		c := *s
+		c.Refs = collapseRefs(s.Refs)
+		c.Implementations = collapseRefs(s.Implementations)
+		filtered[id] = &c
+	}
+	return filtered
+}
+
+// collapseRefs attributes the references located in collapsed files to the file
+func collapseRefs(refs map[string]*types.Ref) map[string]*types.Ref {
+	filtered := make(map[string]*types.Ref)
+	for key, ref := range refs {
+		relPath := ref.FilePath
+		if collapsed(internal.ProjectAbs(relPath)) {
+			c := *ref
+			c.SymbolID = collapsedID(relPath)
+			c.MethodName = filepath.Base(relPath)
+			ref = &c
+		}
+		filtered[key] = ref
+	}
+	return filtered
+}
+
 func addNodeToMap(mapName, nodeName *string) error {
 
 	if *mapName == "" || *nodeName == "" {
@@ -208,8 +263,15 @@ func LoadMap(name *string) (*types.RMap, error) {
 	if !internal.Exists(path) {
 		log.Fatalf("Map: %s does not exist", *name)
 	}
-	if err := getFile(path, rMap); err != nil {
-		return nil, fmt.Errorf("error loading map from file with path: %s, err: %v", err, path)
+	if err := getFile(path, types.MapSchema, rMap); err != nil {
+		var serr *types.SchemaError
+		if !errors.As(err, &serr) || !confirm(fmt.Sprintf("Map: %s can not be read, %v. It will be replaced with an empty map", *name, err)) {
+			return nil, fmt.Errorf("error loading map from file with path: %s, err: %v", path, err)
+		}
+		rMap = types.NewMap(name)
+		if err := marshalAndWriteToFile(rMap, path); err != nil {
+			return nil, fmt.Errorf("error writing to file: %v", err)
+		}
 	}
 	return rMap, nil
 }
@@ -3,7 +3,8 @@ package ops
 import (
 	"encoding/json"
 	"fmt"
-	"os"
+
+	"github.com/JoachimTislov/RefViz/store"
 )
 
 func marshal(v any) ([]byte, error) {
@@ -19,8 +20,5 @@ func marshalAndWriteToFile(v any, filePath string) error {
 	if err != nil {
 		return err
 	}
-	if err := os.WriteFile(filePath, bytes, 0o644); err != nil {
-		return fmt.Errorf("error when writing to file: %s, err: %s", filePath, err)
-	}
-	return nil
+	return store.WriteFile(filePath, bytes)
 }
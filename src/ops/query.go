@@ -0,0 +1,187 @@
+package ops
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/JoachimTislov/RefViz/internal"
+	"github.com/JoachimTislov/RefViz/types"
+)
+
+const (
+	callersQuery = "callers"
+	calleesQuery = "callees"
+	defsQuery    = "defs"
+
+	textFormat  = "text"
+	jsonFormat  = "json"
+	linesFormat = "lines"
+)
+
+// queryResult is a symbol found by a query, with the symbol it was reached from
+type queryResult struct {
+	ID       string `json:"id"`
+	Name     string `json:"name,omitempty"`
+	Kind     string `json:"kind,omitempty"`
+	Location string `json:"location,omitempty"`
+	// Via is the queried symbol, or the symbol it is a caller or callee of
+	Via         string   `json:"via,omitempty"`
+	Depth       int      `json:"depth,omitempty"`
+	Occurrences []string `json:"occurrences,omitempty"`
+}
+
+// Query prints the callers or callees of the symbols matching the pattern, or their definitions
+// The pattern is a symbol id, or a regular expression matching the names of the symbols
+// Callers and callees are found transitively up to the depth, a depth less than 1 has no limit
+func Query(query, pattern, format *string, depth *int) error {
+	if *pattern == "" {
+		return fmt.Errorf("please provide a symbol with -symbol")
+	}
+	defs, err := findDefinitions(*pattern)
+	if err != nil {
+		return err
+	}
+	if len(defs) == 0 {
+		return fmt.Errorf("no symbol found matching: %s", *pattern)
+	}
+
+	var results []queryResult
+	switch *query {
+	case defsQuery:
+		for _, d := range defs {
+			results = append(results, newQueryResult(d.Symbol.ID, definitionLocation(d.Symbol), "", 0, nil))
+		}
+	case callersQuery, calleesQuery:
+		locations := definitionLocations()
+		for _, d := range defs {
+			var edges []types.Edge
+			if *query == callersQuery {
+				edges = cache.Callers(d.Symbol.ID, *depth)
+			} else {
+				edges = cache.Callees(d.Symbol.ID, *depth)
+			}
+			for _, e := range edges {
+				id, via := e.From, e.To
+				if *query == calleesQuery {
+					id, via = e.To, e.From
+				}
+				var occurrences []string
+				for _, ref := range e.Occurrences {
+					occurrences = append(occurrences, location(ref.FilePath, ref.Line, ref.Column))
+				}
+				results = append(results, newQueryResult(id, locations[id], via, e.Depth, occurrences))
+			}
+		}
+	default:
+		return fmt.Errorf("unknown query: %s, expected %s, %s or %s", *query, callersQuery, calleesQuery, defsQuery)
+	}
+	return printResults(*query, *format, results)
+}
+
+// findDefinitions returns the symbol with the id, or the symbols whose name matches the pattern
+func findDefinitions(pattern string) ([]types.Definition, error) {
+	defs := cache.FindDefinitions(func(s *types.Symbol) bool { return s.ID == pattern })
+	if len(defs) > 0 {
+		return defs, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid symbol pattern: %s, err: %v", pattern, err)
+	}
+	return cache.FindDefinitions(func(s *types.Symbol) bool { return re.MatchString(s.Name) }), nil
+}
+
+// definitionLocations returns the location of every cached symbol, keyed by id
+func definitionLocations() map[string]string {
+	locations := make(map[string]string)
+	for _, d := range cache.FindDefinitions(func(*types.Symbol) bool { return true }) {
+		locations[d.Symbol.ID] = definitionLocation(d.Symbol)
+	}
+	return locations
+}
+
+func newQueryResult(id, location, via string, depth int, occurrences []string) queryResult {
+	return queryResult{
+		ID:          id,
+		Name:        nameFromID(id),
+		Kind:        types.KindFromID(id),
+		Location:    location,
+		Via:         via,
+		Depth:       depth,
+		Occurrences: occurrences,
+	}
+}
+
+func definitionLocation(s *types.Symbol) string {
+	line, col := position(s)
+	return location(s.FilePath, line, col)
+}
+
+// position returns the line and the first column of the symbol
+func position(s *types.Symbol) (line, col int) {
+	fmt.Sscanf(s.Position.Line, "%d", &line)
+	fmt.Sscanf(s.Position.CharRange, "%d", &col)
+	return line, col
+}
+
+// location returns file:line:column, which editors can jump to
+func location(filePath string, line, col int) string {
+	if !filepath.IsAbs(filePath) {
+		filePath = filepath.Join(internal.ProjectPath(), filePath)
+	}
+	return fmt.Sprintf("%s:%d:%d", filePath, line, col)
+}
+
+// nameFromID returns the name of the symbol, the last part of the id before the kind
+func nameFromID(id string) string {
+	id, _, _ = strings.Cut(id, "#")
+	return id[strings.LastIndex(id, ".")+1:]
+}
+
+func printResults(query, format string, results []queryResult) error {
+	switch format {
+	case jsonFormat:
+		return printJSON(results)
+	case linesFormat:
+		for _, r := range results {
+			switch {
+			case query == defsQuery:
+				fmt.Printf("%s: %s %s\n", r.Location, r.Kind, r.ID)
+			case query == callersQuery:
+				// the occurrences are where the callers reference the symbol
+				for _, o := range r.Occurrences {
+					fmt.Printf("%s: %s references %s\n", o, r.ID, r.Via)
+				}
+			case r.Location != "":
+				fmt.Printf("%s: %s is used by %s\n", r.Location, r.ID, r.Via)
+			}
+		}
+	case textFormat:
+		if len(results) == 0 {
+			fmt.Printf("No %s found\n", query)
+		}
+		for _, r := range results {
+			if query == defsQuery {
+				fmt.Printf("%s\t%s\n", r.ID, r.Location)
+				continue
+			}
+			relation := "references"
+			if query == calleesQuery {
+				relation = "is used by"
+			}
+			occurrences := "occurrences"
+			if len(r.Occurrences) == 1 {
+				occurrences = "occurrence"
+			}
+			fmt.Printf("%s%s %s %s, %d %s\n", strings.Repeat("\t", r.Depth-1), r.ID, relation, r.Via, len(r.Occurrences), occurrences)
+			if r.Location != "" {
+				fmt.Printf("%s\t%s\n", strings.Repeat("\t", r.Depth-1), r.Location)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown format: %s, expected %s, %s or %s", format, textFormat, jsonFormat, linesFormat)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package ops
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"regexp"
+
+	"github.com/JoachimTislov/RefViz/internal"
+	"github.com/JoachimTislov/RefViz/types"
+)
+
+const unreachableNode = "unreachable"
+
+var unreachableRule = sarifRule{
+	ID:               "unreachable-symbol",
+	ShortDescription: sarifMessage{Text: "Symbol can not be reached from main, init, tests or the exported API"},
+	name:             "unreachable",
+}
+
+// Unreachable prints the scanned symbols which can not be reached from the roots, and returns how many there are
+// The symbols are written to the map as highlighted symbols, if a map name is given
+func Unreachable(kinds, visibility, allowlist, format, mapName *string) (int, error) {
+	filter, err := newFilter(kinds, visibility, allowlist)
+	if err != nil {
+		return 0, err
+	}
+	isRoot, err := configRoots()
+	if err != nil {
+		return 0, err
+	}
+
+	defs := cache.Unreachable(filter, isRoot)
+	if err := printSymbols(defs, *format, unreachableRule); err != nil {
+		return 0, err
+	}
+	if *mapName != "" {
+		written, err := writeUnreachableMap(mapName, defs)
+		if err != nil {
+			return 0, fmt.Errorf("error writing map: %v", err)
+		}
+		if written {
+			log.Printf("Map %s written with %d unreachable symbols\n", *mapName, len(defs))
+		} else {
+			log.Printf("Map %s left as is\n", *mapName)
+		}
+	}
+	return len(defs), nil
+}
+
+// configRoots returns whether the id matches one of the roots in the config
+func configRoots() (func(id string) bool, error) {
+	var roots []*regexp.Regexp
+	for _, root := range config.Roots {
+		re, err := regexp.Compile("^(?:" + root + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid root in config: %s, err: %v", root, err)
+		}
+		roots = append(roots, re)
+	}
+	return func(id string) bool {
+		for _, re := range roots {
+			if re.MatchString(id) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// writeUnreachableMap replaces the map with one node containing the unreachable symbols, highlighted
+// Symbols referenced by them which are reachable are added without highlighting
+// An existing map is only replaced if the user confirms it, returns whether the map was written
+func writeUnreachableMap(mapName *string, defs []types.Definition) (bool, error) {
+	if internal.Exists(internal.GetMapPath(*mapName)) && !confirm(fmt.Sprintf("Map: %s already exists and is replaced with the unreachable symbols", *mapName)) {
+		return false, nil
+	}
+	rMap := types.NewMap(mapName)
+	nodeName := unreachableNode
+	node, err := rMap.GetOrCreateNode(&nodeName, internal.ProjectPath())
+	if err != nil {
+		return false, fmt.Errorf("error getting or creating node: %v", err)
+	}
+
+	byFile := make(map[string]map[string]*types.Symbol)
+	for _, d := range defs {
+		if byFile[d.RelPath] == nil {
+			byFile[d.RelPath] = make(map[string]*types.Symbol)
+		}
+		byFile[d.RelPath][d.Symbol.ID] = d.Symbol
+	}
+	force := true
+	for relPath, symbols := range byFile {
+		absPath := filepath.Join(internal.ProjectPath(), relPath)
+		folder, err := node.RootFolder.GetRelatedFolder(absPath, internal.ProjectPath())
+		if err != nil {
+			return false, fmt.Errorf("error updating to related folder: %v", err)
+		}
+		folderPath, fileName := filepath.Dir(relPath), filepath.Base(relPath)
+		file := folder.GetFile(&fileName, &folderPath)
+		file.Added = true
+		file.AddSymbols(&folder.Refs, &symbols, &folderPath, &fileName, &force)
+		for id := range symbols {
+			file.Highlight(id)
+		}
+		folder.AddFile(file, &force)
+	}
+	if err := rMap.CreateMissingSymbols(internal.ProjectPath()); err != nil {
+		return false, err
+	}
+	return true, marshalAndWriteToFile(rMap, internal.GetMapPath(rMap.Name))
+}
@@ -1,10 +1,12 @@
 package ops
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"path/filepath"
-	"strings"
+	"strconv"
+	"sync"
 
 	"github.com/JoachimTislov/RefViz/internal"
 	"github.com/JoachimTislov/RefViz/lsp"
@@ -12,105 +14,198 @@ import (
 )
 
 const (
-	references = "references"
+	references     = "references"
+	implementation = "implementation"
 )
 
-func getRefs(path string, symbol *types.Symbol, refs *map[string]*types.Ref) func() error {
+func getRefs(ctx context.Context, path string, symbol *types.Symbol, refs *map[string]*types.Ref) func() error {
 	return func() error {
-		pathToSymbol := fmt.Sprintf("%s:%s", path, symbol.Position.String())
-		relPath, err := filepath.Rel(internal.ProjectPath(), path)
-		if err != nil {
-			return fmt.Errorf("error getting relative path: %s, err: %v", path, err)
-		}
+		relPath := internal.ProjectRel(path)
+		pathToSymbol := fmt.Sprintf("%s:%s", relPath, symbol.Position.String())
 
 		log.Printf("\t\t Finding references for symbol: %s\n", symbol.Name)
 
-		output, err := lsp.RunGopls(internal.ProjectPath(), references, pathToSymbol)
+		queryCtx, cancel := context.WithTimeout(ctx, queryTimeout)
+		defer cancel()
+		output, err := findReferences(queryCtx, path, symbol.Position)
 		if err != nil {
-			cache.LogError(fmt.Sprintf("gopls %s %s", references, pathToSymbol))
-			symbol.ZeroRefs = true
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			// the symbol is not marked as unused, so the references are scanned again next time
+			fail(err, "%s %s %s", backendName(path), references, pathToSymbol)
 			return nil
 		}
+		// the references are only stored if all of them are parsed, so an interrupted scan finds them again
+		found := make(map[string]*types.Ref)
+		if err := parseRefs(queryCtx, output, &found); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("error parsing references: %s, err: %v", pathToSymbol, err)
+		}
+		// the symbol is in the cache, which may be flushed by the jobs of other files
+		cache.Mu.Lock()
+		for key, ref := range found {
+			(*refs)[key] = ref
+		}
 		// if there are no references, add the symbol to the unused symbols list
-		if string(output) == "" {
-			symbol.ZeroRefs = true
+		symbol.ZeroRefs = len(output) == 0
+		symbol.Scanned = true
+		cache.Mu.Unlock()
+		if !symbol.ZeroRefs {
+			cache.RemoveUnusedSymbol(relPath, symbol.ID)
+		} else {
 			// Add to unused map in the cache
-			cache.AddUnusedSymbol(relPath, symbol.Name, types.NewUnusedSymbol(
+			cache.AddUnusedSymbol(relPath, symbol.ID, types.NewUnusedSymbol(
 				filepath.Base(filepath.Dir(path)),
 				filepath.Base(path),
 				pathToSymbol,
 			))
 		}
 
-		if err := parseRefs(string(output), refs); err != nil {
-			return fmt.Errorf("error parsing references: %s, err: %v", pathToSymbol, err)
+		if symbol.Kind == iface {
+			if err := getImplementations(queryCtx, path, symbol); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				fail(err, "%s %s %s", backendName(path), implementation, pathToSymbol)
+			}
 		}
-
 		return nil
 	}
 }
 
-func parseRefs(output string, refs *map[string]*types.Ref) error {
-	lines := strings.Split(output, "\n")
-	for _, line := range lines {
-		if line == "" {
-			continue
+// getImplementations finds the types implementing the interface, stored next to the references of the symbol
+func getImplementations(ctx context.Context, path string, symbol *types.Symbol) error {
+	pos, err := lspPosition(symbol.Position)
+	if err != nil {
+		return err
+	}
+	b, err := getBackend(ctx, path)
+	if err != nil {
+		return err
+	}
+	output, err := b.Implementations(ctx, path, pos)
+	if err != nil {
+		return err
+	}
+	implementations := make(map[string]*types.Ref)
+	for _, loc := range output {
+		ref, err := newRef(ctx, loc)
+		if err != nil {
+			return err
 		}
-		args := strings.Split(line, ":")
-		path := args[0]
-		LinePos := args[1]
+		if ref != nil {
+			implementations[ref.SymbolID] = ref
+		}
+	}
+	cache.Mu.Lock()
+	symbol.Implementations = implementations
+	cache.Mu.Unlock()
+	return nil
+}
 
-		fileName := filepath.Base(path)
-		folderName := filepath.Base(filepath.Dir(path))
+func findReferences(ctx context.Context, path string, p types.Position) ([]lsp.Location, error) {
+	pos, err := lspPosition(p)
+	if err != nil {
+		return nil, err
+	}
+	b, err := getBackend(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return b.References(ctx, path, pos)
+}
 
-		parentSymbolName, err := getRelatedMethod(path, LinePos)
+func parseRefs(ctx context.Context, output []lsp.Location, refs *map[string]*types.Ref) error {
+	for _, loc := range output {
+		ref, err := newRef(ctx, loc)
 		if err != nil {
-			return fmt.Errorf("error getting related method: %s, err: %v", path, err)
+			return err
 		}
-		(*refs)[path] = &types.Ref{
-			Path:       fmt.Sprintf("%s:%s:%s", path, args[1], args[2]),
-			FilePath:   path,
-			FolderName: folderName,
-			FileName:   fileName,
-			MethodName: *parentSymbolName,
+		if ref != nil {
+			(*refs)[ref.Path] = ref
 		}
 	}
 	return nil
 }
 
-// getRelatedMethod finds the closest method above the reference
-func getRelatedMethod(path string, refLinePos string) (*string, error) {
-	c, _, err := getSymbols(path, false)
+// newRef creates a reference attributed to the symbol enclosing the location, with the path relative to the project
+// Returns nil if the location is not inside a symbol
+func newRef(ctx context.Context, loc lsp.Location) (*types.Ref, error) {
+	path := lsp.Path(loc.URI)
+	relPath := internal.ProjectRel(path)
+	LinePos := strconv.Itoa(loc.Range.Start.Line + 1)
+
+	parent, err := enclosingSymbol(ctx, path, loc.Range.Start)
 	if err != nil {
-		return nil, fmt.Errorf("error getting symbols: %s, err: %v", path, err)
+		return nil, fmt.Errorf("error getting enclosing symbol: %s, err: %v", path, err)
 	}
-	if len(c.Symbols) == 0 {
-		return nil, fmt.Errorf("zero symbols found in %s", path)
+	if parent == nil {
+		// e.g. blank identifiers, var _ Interface = (*T)(nil), are not reported as symbols
+		log.Printf("\t\t No enclosing symbol for reference: %s:%s\n", path, LinePos)
+		return nil, nil
 	}
-	var parentSymbol *types.Symbol
-	// loop through potential parent symbols
-	for _, s := range c.Symbols {
-		// skip if the symbol is not a function
-		if s.Kind != function && s.Kind != method {
-			continue
-		}
-		if parentSymbol == nil {
-			parentSymbol = s
-			continue
-		}
-		isFurtherDown := parentSymbol.Position.Line < s.Position.Line
-		isAboveRef := s.Position.Line < refLinePos
-		if isFurtherDown && isAboveRef {
-			parentSymbol = s
-		}
+	return &types.Ref{
+		Path:       fmt.Sprintf("%s:%s:%d-%d", relPath, LinePos, loc.Range.Start.Character+1, loc.Range.End.Character+1),
+		Line:       loc.Range.Start.Line + 1,
+		Column:     loc.Range.Start.Character + 1,
+		FilePath:   relPath,
+		FolderName: filepath.Base(filepath.Dir(path)),
+		FileName:   filepath.Base(path),
+		MethodName: symbolName(parent),
+		SymbolID:   symbolID(path, parent),
+	}, nil
+}
+
+// enclosingSymbol returns the innermost symbol whose full range contains the reference
+// Closures resolve to the function they are declared in, references in top-level declarations to the declaration
+func enclosingSymbol(ctx context.Context, path string, pos lsp.Position) (*lsp.DocumentSymbol, error) {
+	symbols, err := refSymbols.get(ctx, path)
+	if err != nil {
+		return nil, err
 	}
-	if parentSymbol == nil {
-		for _, s := range c.Symbols {
-			if s.Position.Line == refLinePos {
-				return &s.Name, nil
-			}
+	return lsp.EnclosingSymbol(symbols, pos), nil
+}
+
+// symbolCache keeps the symbols of the files references are located in, so each file is queried once per scan
+// instead of once per reference
+type symbolCache struct {
+	mu    sync.Mutex
+	files map[string]*fileSymbols
+}
+
+// fileSymbols are queried by the first job needing them, the other jobs wait for the result
+type fileSymbols struct {
+	once    sync.Once
+	symbols []lsp.DocumentSymbol
+	err     error
+}
+
+func newSymbolCache() *symbolCache {
+	return &symbolCache{files: make(map[string]*fileSymbols)}
+}
+
+// get returns the symbols of the file, failed queries are not cached
+func (c *symbolCache) get(ctx context.Context, path string) ([]lsp.DocumentSymbol, error) {
+	c.mu.Lock()
+	f, ok := c.files[path]
+	if !ok {
+		f = &fileSymbols{}
+		c.files[path] = f
+	}
+	c.mu.Unlock()
+
+	f.once.Do(func() {
+		f.symbols, f.err = documentSymbols(ctx, path)
+	})
+	if f.err != nil {
+		c.mu.Lock()
+		if c.files[path] == f {
+			delete(c.files, path)
 		}
-		panic(fmt.Sprintf("Parent symbol is nil, path: %s, line: %s", path, refLinePos))
+		c.mu.Unlock()
 	}
-	return &parentSymbol.Name, nil
+	return f.symbols, f.err
 }
@@ -0,0 +1,146 @@
+package ops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/JoachimTislov/RefViz/internal"
+	"github.com/JoachimTislov/RefViz/lsp"
+)
+
+type failure struct {
+	command string
+	err     error
+}
+
+// failures of the current scan, reported when it is done
+var failures struct {
+	mu   sync.Mutex
+	list []failure
+}
+
+// fail stores the command in the cache, so it can be retried with -retry-errors, and adds it to the scan report
+// The command has the format: <backend> <symbols|references|implementation> <location>
+func fail(err error, format string, a ...any) {
+	command := fmt.Sprintf(format, a...)
+	cache.LogError(command)
+
+	failures.mu.Lock()
+	defer failures.mu.Unlock()
+	failures.list = append(failures.list, failure{command: command, err: err})
+}
+
+// report logs the failures of the scan, including the stderr of the language server
+// Returns an error if anything failed
+func report() error {
+	failures.mu.Lock()
+	defer failures.mu.Unlock()
+	if len(failures.list) == 0 {
+		return nil
+	}
+	log.Printf("Scan report, %d failed:\n", len(failures.list))
+	for _, f := range failures.list {
+		log.Printf("\t%s: %v\n", f.command, f.err)
+		var serr *lsp.ServerError
+		if errors.As(f.err, &serr) && serr.Stderr() != "" {
+			for _, line := range strings.Split(serr.Stderr(), "\n") {
+				log.Printf("\t\t%s\n", line)
+			}
+		}
+	}
+	log.Println("Use the -retry-errors flag to scan them again")
+	n := len(failures.list)
+	failures.list = nil
+	return fmt.Errorf("%d files or symbols failed to scan", n)
+}
+
+// RetryErrors scans the failed files and symbols stored in the cache again
+// Commands which fail again are kept in the cache
+func RetryErrors(ctx context.Context) error {
+	commands := cache.TakeErrors()
+	if len(commands) == 0 {
+		log.Println("No errors to retry")
+		return nil
+	}
+	log.Printf("Retrying %d failed commands\n", len(commands))
+
+	files := make(map[string]bool)
+	for _, command := range commands {
+		path, err := retry(command)
+		if err != nil {
+			return err
+		}
+		if path != "" {
+			files[path] = true
+		}
+	}
+	if err := saveCache(); err != nil {
+		return fmt.Errorf("error saving cache: %v", err)
+	}
+	var paths []string
+	for path := range files {
+		paths = append(paths, path)
+	}
+	var everythingIsUpToDate atomic.Bool
+	everythingIsUpToDate.Store(true)
+	if err := scanFiles(ctx, paths, false, &everythingIsUpToDate); err != nil {
+		return checkpoint(ctx, fmt.Errorf("error scanning files: %v", err))
+	}
+	if err := saveCache(); err != nil {
+		return fmt.Errorf("error saving cache: %v", err)
+	}
+	return report()
+}
+
+// retry prepares the command to be run again and returns the file to scan
+// The hash of files with failed symbols is dropped, so they are scanned again even if they did not change since the failure,
+// and the symbols of failed references are marked as stale
+func retry(command string) (string, error) {
+	parts := strings.SplitN(command, " ", 3)
+	if len(parts) != 3 {
+		log.Printf("Skipping invalid command: %s\n", command)
+		return "", nil
+	}
+	query, location := parts[1], parts[2]
+	if query == symbols {
+		if cache.HasEntry(location) {
+			entry := cache.GetEntry(location)
+			entry.Hash = ""
+			cache.AddEntry(location, entry)
+			cacheStore.Update(location)
+		}
+		return internal.ProjectAbs(location), nil
+	}
+	// location is path:line:charRange
+	i := strings.LastIndex(location, ":")
+	if i < 0 {
+		log.Printf("Skipping invalid command: %s\n", command)
+		return "", nil
+	}
+	j := strings.LastIndex(location[:i], ":")
+	if j < 0 {
+		log.Printf("Skipping invalid command: %s\n", command)
+		return "", nil
+	}
+	path, pos := internal.ProjectAbs(location[:j]), location[j+1:]
+	if _, err := os.Stat(path); err != nil {
+		log.Printf("Skipping command for missing file: %s\n", command)
+		return "", nil
+	}
+	relPath := internal.ProjectRel(path)
+	for _, s := range cache.GetEntry(relPath).Symbols {
+		if s.Position.String() == pos {
+			s.Stale = true
+			cacheStore.Update(relPath)
+			return path, nil
+		}
+	}
+	log.Printf("Skipping command for missing symbol: %s\n", command)
+	return "", nil
+}
@@ -1,11 +1,13 @@
 package ops
 
 import (
+	"context"
 	"fmt"
 	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"time"
 
 	"github.com/JoachimTislov/RefViz/internal"
@@ -17,61 +19,211 @@ import (
 // If the content is a directory, it scans all files in the directory
 // If scanForRefs is true, it scans for references
 // If the content is a file, it only scans the file
-func Scan(content *string, scanAgain, ask *bool) error {
+// If gitDiff is true, cached files are only scanned if git reports them as changed since the cached commit
+// An interrupted scan saves the cache with the unfinished files, which the next scan resumes
+func Scan(ctx context.Context, content *string, scanAgain, ask, gitDiff *bool) error {
 	paths, err := findContent(content, ask)
 	if err != nil {
 		return fmt.Errorf("error finding content: %s, err: %v", *content, err)
 	}
+	var changed map[string]bool
+	if *gitDiff && !*scanAgain {
+		if changed, err = changedFiles(); err != nil {
+			return fmt.Errorf("error finding changed files: %v", err)
+		}
+	}
 	// Start the timer
 	// This is used to calculate the time it takes to scan the content
 	startNow := time.Now()
 
-	everythingIsUpToDate := true
+	var files []string
 	for _, path := range paths {
-		if err := processPath(path, *scanAgain, &everythingIsUpToDate); err != nil {
+		if err := processPath(path, changed, &files); err != nil {
 			return fmt.Errorf("error processing path: %v", err)
 		}
 	}
+	if unfinished := cache.UnfinishedFiles(); len(unfinished) > 0 && !*scanAgain {
+		log.Printf("Resuming %d unfinished files of the interrupted scan\n", len(unfinished))
+		files = resume(unfinished, files)
+	}
+	if err := invalidate(files); err != nil {
+		return fmt.Errorf("error invalidating references: %v", err)
+	}
 
-	if everythingIsUpToDate {
+	var everythingIsUpToDate atomic.Bool
+	everythingIsUpToDate.Store(true)
+	if err := scanFiles(ctx, files, *scanAgain, &everythingIsUpToDate); err != nil {
+		return checkpoint(ctx, fmt.Errorf("error scanning files: %v", err))
+	}
+	// symbols in files outside the content may reference the changed files
+	if err := scanStale(ctx, &everythingIsUpToDate); err != nil {
+		return checkpoint(ctx, fmt.Errorf("error scanning stale references: %v", err))
+	}
+	// the commit only describes the cache if the whole project was scanned
+	if *content == "" {
+		if err := recordCommit(); err != nil {
+			return fmt.Errorf("error recording commit: %v", err)
+		}
+	}
+
+	collect()
+	if err := saveCache(); err != nil {
+		return fmt.Errorf("error saving cache: %v", err)
+	}
+
+	if everythingIsUpToDate.Load() {
 		log.Println("Everything is up to date\n Use the -a flag to scan again")
 	} else {
 		log.Printf("Scan time: %v\n", time.Since(startNow))
 	}
 
-	return nil
+	return report()
 }
 
-func processPath(path string, scanAgain bool, everythingIsUpToDate *bool) error {
-	e, valid := checkIfValid(path)
-	if !valid {
-		return fmt.Errorf("error: %s is not a valid entity", path)
+// processPath adds the files of the path to files, skipping unchanged files if changed is not nil
+func processPath(path string, changed map[string]bool, files *[]string) error {
+	e, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("error: %s is not a valid entity, err: %v", path, err)
+	}
+	if reason := skipReason(e.IsDir(), path); reason != "" {
+		return fmt.Errorf("error: %s is skipped, %s", path, reason)
 	}
-	paths := []string{path}
+	var paths []string
 	// If the path is a directory, get all the files in the directory
 	if e.IsDir() {
 		if err := getContentInDir(path, &paths); err != nil {
 			return fmt.Errorf("error getting content in directory: %s, err: %v", path, err)
 		}
+	} else {
+		paths = append(paths, path)
+	}
+	if changed != nil {
+		paths = skipUnchanged(paths, changed)
 	}
+	*files = append(*files, paths...)
+	return nil
+}
 
-	var jobs []func() error
+// scanFiles scans the files, which are unfinished until their symbols and references are cached
+// The symbols of every file are scanned before the references
+func scanFiles(ctx context.Context, paths []string, scanAgain bool, everythingIsUpToDate *atomic.Bool) error {
+	// files may have changed since the last scan
+	refSymbols = newSymbolCache()
+	scheduler := newScheduler()
 	for _, path := range paths {
-		jobs = append(jobs, getContent(path, scanAgain, everythingIsUpToDate))
+		relPath, err := filepath.Rel(internal.ProjectPath(), path)
+		if err != nil {
+			return fmt.Errorf("error getting relative path: %s, err: %v", path, err)
+		}
+		cache.AddUnfinished(relPath)
+		scheduler.Submit(routines.High, path, getContent(ctx, scheduler, path, scanAgain, everythingIsUpToDate))
+	}
+	return scheduler.Run(ctx)
+}
+
+// newScheduler creates a scheduler limited to the number of jobs set with -j, logging the progress
+func newScheduler() *routines.Scheduler {
+	scheduler := routines.NewScheduler(jobs)
+	scheduler.OnProgress = func(p routines.Progress) {
+		if p.Done%progressInterval == 0 || p.Done == p.Total {
+			log.Printf("Progress: %d/%d jobs done\n", p.Done, p.Total)
+		}
 	}
+	return scheduler
+}
 
-	// Start the work for 4 workers
-	routines.StartWork(3, jobs)
+// SetExplain makes scans and additions to maps log why paths are skipped
+func SetExplain(b bool) {
+	explain = b
+}
 
-	return nil
+// SetJobs sets the number of jobs running at once, the number of CPUs if n is less than 1
+func SetJobs(n int) {
+	jobs = n
 }
 
-func getContentInDir(path string, paths *[]string) error {
-	return filepath.WalkDir(path, func(path string, d os.DirEntry, err error) error {
+// resume adds the unfinished files of an interrupted scan before the files, unless they are already included
+func resume(unfinished, files []string) []string {
+	included := make(map[string]bool, len(files))
+	for _, path := range files {
+		included[path] = true
+	}
+	var paths []string
+	for _, relPath := range unfinished {
+		path := filepath.Join(internal.ProjectPath(), relPath)
+		if !included[path] && internal.Exists(path) {
+			paths = append(paths, path)
+		}
+	}
+	return append(paths, files...)
+}
+
+// checkpoint saves the cache if the scan was interrupted, so the unfinished files can be resumed
+// Returns the error otherwise
+func checkpoint(ctx context.Context, err error) error {
+	if ctx.Err() == nil {
+		return err
+	}
+	if err := saveCache(); err != nil {
+		return fmt.Errorf("error saving cache: %v", err)
+	}
+	log.Printf("Scan interrupted, %d files are unfinished\n Run the scan again to resume\n", len(cache.UnfinishedFiles()))
+	return fmt.Errorf("scan interrupted")
+}
+
+// changedFiles returns the files git reports as changed since the commit the cache was built at
+// Returns nil, meaning every file is checked, if no commit is recorded
+func changedFiles() (map[string]bool, error) {
+	if cache.Commit == "" {
+		log.Println("No commit recorded in the cache, checking every file")
+		return nil, nil
+	}
+	paths, err := internal.GitChangedFiles(internal.ProjectPath(), cache.Commit)
+	if err != nil {
+		return nil, err
+	}
+	changed := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		changed[p] = true
+	}
+	return changed, nil
+}
+
+// skipUnchanged removes the cached files which are not changed
+func skipUnchanged(paths []string, changed map[string]bool) []string {
+	var result []string
+	for _, p := range paths {
+		relPath, err := filepath.Rel(internal.ProjectPath(), p)
+		if err != nil || changed[p] || !cache.HasEntry(relPath) {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// recordCommit stores the checked out commit in the cache, ignored outside of git repositories
+func recordCommit() error {
+	head, err := internal.GitHead(internal.ProjectPath())
+	if err != nil {
+		return nil
+	}
+	cache.Commit = head
+	return saveCache()
+}
+
+func getContentInDir(root string, paths *[]string) error {
+	return filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			return fmt.Errorf("error walking through directory: %s, err: %v", path, err)
 		}
-		if !d.IsDir() && isValid(d.IsDir(), path) {
+		if d.IsDir() {
+			if path != root && skip(true, path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !skip(false, path) {
 			*paths = append(*paths, path)
 		}
 		return nil
@@ -1,11 +1,17 @@
 package ops
 
 import (
+	"context"
 	"fmt"
+	"go/parser"
+	"go/token"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/JoachimTislov/RefViz/internal"
 	"github.com/JoachimTislov/RefViz/lsp"
@@ -16,19 +22,25 @@ const (
 	symbols = "symbols"
 )
 
-func getSymbol(path, symbolName string, forceScan *bool) (*types.Symbol, error) {
-	entry, _, err := getSymbols(path, *forceScan)
+var (
+	testPackagesMu sync.Mutex
+	// testPackages caches the names of the external test packages of test files, keyed by absolute path
+	testPackages = make(map[string]string)
+)
+
+func getSymbol(ctx context.Context, path, id string, forceScan *bool) (*types.Symbol, error) {
+	entry, _, err := getSymbols(ctx, path, *forceScan)
 	if err != nil {
 		return nil, fmt.Errorf("error getting symbols: %v", err)
 	}
-	s, ok := entry.Symbols[symbolName]
+	s, ok := entry.Symbols[id]
 	if !ok {
-		return nil, fmt.Errorf("symbol not found: %s", symbolName)
+		return nil, fmt.Errorf("symbol not found: %s", id)
 	}
 	return s, nil
 }
 
-func getSymbols(filePath string, scanAgain bool) (*types.CacheEntry, bool, error) {
+func getSymbols(ctx context.Context, filePath string, scanAgain bool) (*types.CacheEntry, bool, error) {
 
 	f, err := os.Stat(filePath)
 	if err != nil {
@@ -40,22 +52,34 @@ func getSymbols(filePath string, scanAgain bool) (*types.CacheEntry, bool, error
 		return nil, false, fmt.Errorf("error checking cache: %s, err: %v", filePath, err)
 	}
 
-	modTime := f.ModTime().Unix()
-	shouldScan := entry.ModTime != modTime || scanAgain
+	modTime := f.ModTime().UnixNano()
+	shouldScan, hash, err := hasChanged(entry, filePath, modTime)
+	if err != nil {
+		return nil, false, err
+	}
+	shouldScan = shouldScan || scanAgain
 	if shouldScan {
 
 		log.Printf("\tScanning for symbols for file: %s\n", filePath)
 
-		output, err := lsp.RunGopls(internal.ProjectPath(), symbols, filePath)
+		queryCtx, cancel := context.WithTimeout(ctx, queryTimeout)
+		defer cancel()
+		output, err := documentSymbols(queryCtx, filePath)
 		if err != nil {
-			cache.LogError(fmt.Sprintf("gopls %s %s", symbols, filePath))
+			// an interrupted scan is not a failure, the file is scanned again when the scan is resumed
+			if ctx.Err() != nil {
+				return nil, false, ctx.Err()
+			}
+			fail(err, "%s %s %s", backendName(filePath), symbols, internal.ProjectRel(filePath))
 			return nil, false, nil
 		}
 
-		parseSymbols(string(output), filePath, &entry.Symbols)
+		entry.Symbols = make(map[string]*types.Symbol)
+		parseSymbols(output, filePath, "", &entry.Symbols)
 
 		entry.Name = filepath.Base(filePath)
 		entry.ModTime = modTime
+		entry.Hash = hash
 
 		log.Printf("\tCaching symbols for file: %s\n", filePath)
 
@@ -66,6 +90,29 @@ func getSymbols(filePath string, scanAgain bool) (*types.CacheEntry, bool, error
 	return entry, shouldScan, nil
 }
 
+// hasChanged compares the content hash of the file with the cached one, if the modification time differs
+// A touched or checked out file with the same content only updates the modification time in the cache
+func hasChanged(entry *types.CacheEntry, filePath string, modTime int64) (bool, string, error) {
+	if entry.ModTime == modTime && entry.Hash != "" {
+		return false, entry.Hash, nil
+	}
+	hash, err := internal.HashFile(filePath)
+	if err != nil {
+		return false, "", err
+	}
+	if hash != entry.Hash {
+		return true, hash, nil
+	}
+	relPath, err := filepath.Rel(internal.ProjectPath(), filePath)
+	if err != nil {
+		return false, "", fmt.Errorf("error getting relative path: %s, err: %v", filePath, err)
+	}
+	entry.ModTime = modTime
+	cache.AddEntry(relPath, entry)
+	cacheStore.Update(relPath)
+	return false, hash, nil
+}
+
 func checkCache(filePath string) (*types.CacheEntry, error) {
 	relPath, err := filepath.Rel(internal.ProjectPath(), filePath)
 	if err != nil {
@@ -74,39 +121,132 @@ func checkCache(filePath string) (*types.CacheEntry, error) {
 	return cache.GetEntry(relPath), nil
 }
 
-// parses the output of the gopls symbols command and extracts the name, kind, and position of each symbol
-func parseSymbols(output, filePath string, s *map[string]*types.Symbol) {
-	// retrieve values from last, to handle this specific case: uint64 | string Field 27:2-27:17
-	// the usual case is: uint64 Field 27:2-27:17, name, kind, position
-	for _, line := range strings.Split(output, "\n") {
-		args := strings.Split(line, " ")
-		l := len(args)
-		if l < 3 {
-			continue
+func documentSymbols(ctx context.Context, filePath string) ([]lsp.DocumentSymbol, error) {
+	b, err := getBackend(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	return b.Symbols(ctx, filePath)
+}
+
+// parses the document symbols and extracts the name, kind, and position of each symbol
+// nested symbols, such as struct fields, are flattened into the same map, keyed by their id
+// the paths of the symbols are stored relative to the project
+func parseSymbols(output []lsp.DocumentSymbol, filePath, container string, s *map[string]*types.Symbol) {
+	relPath := internal.ProjectRel(filePath)
+	for _, ds := range output {
+		if ds.Container == "" {
+			ds.Container = container
 		}
-		name := strings.TrimSpace(strings.Join(args[:l-2], " ")) // name is everything except the last 2 elements
-		kind := args[l-2]
-		// for methods, remove the receiver type
-		// (*Service[K, V]).SendTo Method -> SendTo
-		if kind == method && strings.Contains(name, ".") {
-			name = strings.Split(name, ".")[1]
+		id := symbolID(filePath, &ds)
+		(*s)[id] = &types.Symbol{
+			ID:       id,
+			Name:     symbolName(&ds),
+			Kind:     ds.Kind.String(),
+			Path:     fmt.Sprintf("%s:%s", relPath, span(ds.SelectionRange)),
+			FilePath: relPath,
+			Position: createPosition(ds.SelectionRange),
 		}
-		(*s)[name] = &types.Symbol{
-			Name:     name,
-			Kind:     kind,
-			Path:     fmt.Sprintf("%s:%s", filePath, args[l-1]),
-			FilePath: filePath,
-			Position: createPosition(args[l-1]),
+		parseSymbols(ds.Children, filePath, ds.Name, s)
+	}
+}
+
+// symbolName returns the name of the symbol, for methods the receiver type is removed
+// (*Service[K, V]).SendTo Method -> SendTo
+func symbolName(ds *lsp.DocumentSymbol) string {
+	name := strings.TrimSpace(ds.Name)
+	if ds.Kind.String() == method && strings.Contains(name, ".") {
+		name = name[strings.LastIndex(name, ".")+1:]
+	}
+	return name
+}
+
+// symbolID identifies the symbol by the package, receiver type, name and kind
+// A package may have several init functions, they are told apart by their file and line: init@main:12
+func symbolID(filePath string, ds *lsp.DocumentSymbol) string {
+	receiver := ds.Container
+	name := strings.TrimSpace(ds.Name)
+	if i := strings.LastIndex(name, "."); ds.Kind.String() == method && strings.HasPrefix(name, "(") && i > 0 {
+		receiver = name[:i]
+	}
+	name = symbolName(ds)
+	if name == "init" && receiver == "" && ds.Kind.String() == function {
+		name = fmt.Sprintf("init@%s:%d", strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath)), ds.SelectionRange.Start.Line+1)
+	}
+	return types.SymbolID(symbolPackage(filePath), receiverName(receiver), name, ds.Kind.String())
+}
+
+// symbolPackage returns the package directory of the file relative to the project
+// External test packages share the directory with the package they test, their name is added to it: web/hooks/hooks_test
+func symbolPackage(filePath string) string {
+	pkg, err := filepath.Rel(internal.ProjectPath(), filepath.Dir(filePath))
+	if err != nil {
+		pkg = filepath.Dir(filePath)
+	}
+	pkg = filepath.ToSlash(pkg)
+	if name := testPackage(filePath); name != "" {
+		pkg = path.Join(pkg, name)
+	}
+	return pkg
+}
+
+// testPackage returns the name of the external test package of the file, or an empty string for other files
+func testPackage(filePath string) string {
+	if !strings.HasSuffix(filePath, "_test.go") {
+		return ""
+	}
+	testPackagesMu.Lock()
+	defer testPackagesMu.Unlock()
+	name, ok := testPackages[filePath]
+	if !ok {
+		// files which can not be parsed are treated as part of the package
+		if f, err := parser.ParseFile(token.NewFileSet(), filePath, nil, parser.PackageClauseOnly); err == nil && strings.HasSuffix(f.Name.Name, "_test") {
+			name = f.Name.Name
 		}
+		testPackages[filePath] = name
 	}
+	return name
+}
+
+// forgetTestPackage drops the cached test package name of the changed file
+func forgetTestPackage(filePath string) {
+	testPackagesMu.Lock()
+	defer testPackagesMu.Unlock()
+	delete(testPackages, filePath)
+}
+
+// receiverName removes pointers, parentheses and type parameters from the receiver type
+// (*Service[K, V]) -> Service
+func receiverName(receiver string) string {
+	receiver = strings.Trim(receiver, "()*")
+	if i := strings.Index(receiver, "["); i >= 0 {
+		receiver = receiver[:i]
+	}
+	return strings.TrimSpace(receiver)
+}
+
+// span formats the range like gopls does on the command line, one based: 27:2-27:17
+func span(r lsp.Range) string {
+	return fmt.Sprintf("%d:%d-%d:%d", r.Start.Line+1, r.Start.Character+1, r.End.Line+1, r.End.Character+1)
 }
 
 // Gets the line and character range position of the symbol
-func createPosition(p string) types.Position {
-	args := strings.Split(p, "-")
-	args2 := strings.Split(args[0], ":")
+func createPosition(r lsp.Range) types.Position {
 	return types.Position{
-		Line:      args2[0], // starting line position
-		CharRange: fmt.Sprintf("%s-%s", args2[1], strings.Split(args[1], ":")[1]),
+		Line:      strconv.Itoa(r.Start.Line + 1), // starting line position
+		CharRange: fmt.Sprintf("%d-%d", r.Start.Character+1, r.End.Character+1),
+	}
+}
+
+// lspPosition converts the one based position of a symbol to a zero based protocol position
+func lspPosition(p types.Position) (lsp.Position, error) {
+	line, err := strconv.Atoi(p.Line)
+	if err != nil {
+		return lsp.Position{}, fmt.Errorf("invalid line: %s", p.Line)
+	}
+	char, err := strconv.Atoi(strings.Split(p.CharRange, "-")[0])
+	if err != nil {
+		return lsp.Position{}, fmt.Errorf("invalid character range: %s", p.CharRange)
 	}
+	return lsp.Position{Line: line - 1, Character: char - 1}, nil
 }
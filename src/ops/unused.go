@@ -0,0 +1,252 @@
+package ops
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/JoachimTislov/RefViz/types"
+)
+
+const sarifFormat = "sarif"
+
+var unusedRule = sarifRule{
+	ID:               "unused-symbol",
+	ShortDescription: sarifMessage{Text: "Symbol is never referenced"},
+	name:             "unused",
+}
+
+// unusedPackage is the unused symbols of a package directory
+type unusedPackage struct {
+	Package string         `json:"package"`
+	Symbols []unusedSymbol `json:"symbols"`
+}
+
+type unusedSymbol struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Kind     string `json:"kind"`
+	Location string `json:"location"`
+	RelPath  string `json:"-"`
+	Line     int    `json:"-"`
+	Column   int    `json:"-"`
+}
+
+// Unused prints the scanned symbols without references, grouped by package, and returns how many there are
+// kinds is a comma separated list of kinds, visibility is exported or unexported, both are reported if empty
+// The allowlist file has a regular expression per line, symbols with a matching id are not reported
+func Unused(kinds, visibility, allowlist, format *string, testRefs *bool) (int, error) {
+	filter, err := newFilter(kinds, visibility, allowlist)
+	if err != nil {
+		return 0, err
+	}
+	filter.TestRefs = *testRefs
+
+	defs := cache.Unused(filter)
+	if err := printSymbols(defs, *format, unusedRule); err != nil {
+		return 0, err
+	}
+	return len(defs), nil
+}
+
+// newFilter creates the filter of the reported symbols from the flags
+func newFilter(kinds, visibility, allowlist *string) (types.UnusedFilter, error) {
+	filter := types.UnusedFilter{Visibility: *visibility}
+	if filter.Visibility != "" && filter.Visibility != types.Exported && filter.Visibility != types.Unexported {
+		return filter, fmt.Errorf("unknown visibility: %s, expected %s or %s", *visibility, types.Exported, types.Unexported)
+	}
+	for _, kind := range strings.Split(*kinds, ",") {
+		if kind = strings.TrimSpace(kind); kind != "" {
+			if filter.Kinds == nil {
+				filter.Kinds = make(map[string]bool)
+			}
+			filter.Kinds[kind] = true
+		}
+	}
+	if *allowlist != "" {
+		allowed, err := loadAllowlist(*allowlist)
+		if err != nil {
+			return filter, err
+		}
+		filter.Allowed = allowed
+	}
+	return filter, nil
+}
+
+// printSymbols prints the reported symbols grouped by package
+func printSymbols(defs []types.Definition, format string, rule sarifRule) error {
+	packages := groupByPackage(defs)
+	switch format {
+	case textFormat:
+		if len(defs) == 0 {
+			fmt.Printf("No %s symbols found\n", rule.name)
+		}
+		for _, p := range packages {
+			fmt.Printf("%s (%d)\n", p.Package, len(p.Symbols))
+			for _, s := range p.Symbols {
+				fmt.Printf("\t%s\t%s\t%s\n", s.Kind, s.ID, s.Location)
+			}
+		}
+	case linesFormat:
+		for _, p := range packages {
+			for _, s := range p.Symbols {
+				fmt.Printf("%s: %s %s %s\n", s.Location, rule.name, s.Kind, s.ID)
+			}
+		}
+	case jsonFormat:
+		return printJSON(packages)
+	case sarifFormat:
+		return printJSON(newSarif(packages, rule))
+	default:
+		return fmt.Errorf("unknown format: %s, expected %s, %s, %s or %s", format, textFormat, jsonFormat, linesFormat, sarifFormat)
+	}
+	return nil
+}
+
+// loadAllowlist reads the regular expressions of the allowlist, empty lines and lines starting with // are skipped
+func loadAllowlist(path string) (func(id string) bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening allowlist: %v", err)
+	}
+	defer file.Close()
+
+	var patterns []*regexp.Regexp
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		re, err := regexp.Compile("^(?:" + line + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern in allowlist: %s, err: %v", line, err)
+		}
+		patterns = append(patterns, re)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading allowlist: %v", err)
+	}
+	return func(id string) bool {
+		for _, re := range patterns {
+			if re.MatchString(id) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+func groupByPackage(defs []types.Definition) []unusedPackage {
+	byPackage := make(map[string][]unusedSymbol)
+	for _, d := range defs {
+		pkg := filepath.Dir(d.RelPath)
+		line, col := position(d.Symbol)
+		byPackage[pkg] = append(byPackage[pkg], unusedSymbol{
+			ID:       d.Symbol.ID,
+			Name:     d.Symbol.Name,
+			Kind:     d.Symbol.Kind,
+			Location: definitionLocation(d.Symbol),
+			RelPath:  d.RelPath,
+			Line:     line,
+			Column:   col,
+		})
+	}
+	packages := make([]unusedPackage, 0, len(byPackage))
+	for pkg, symbols := range byPackage {
+		packages = append(packages, unusedPackage{Package: pkg, Symbols: symbols})
+	}
+	sort.Slice(packages, func(i, j int) bool { return packages[i].Package < packages[j].Package })
+	return packages
+}
+
+func printJSON(v any) error {
+	bytes, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return fmt.Errorf("error marshalling results: %v", err)
+	}
+	fmt.Println(string(bytes))
+	return nil
+}
+
+// sarif is the subset of SARIF 2.1.0 used by code review tools to annotate files
+type sarif struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver struct {
+		Name  string      `json:"name"`
+		Rules []sarifRule `json:"rules"`
+	} `json:"driver"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+	// name describes the reported symbols in the text output
+	name string
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI       string `json:"uri"`
+			URIBaseID string `json:"uriBaseId"`
+		} `json:"artifactLocation"`
+		Region struct {
+			StartLine   int `json:"startLine"`
+			StartColumn int `json:"startColumn,omitempty"`
+		} `json:"region"`
+	} `json:"physicalLocation"`
+}
+
+func newSarif(packages []unusedPackage, rule sarifRule) sarif {
+	run := sarifRun{Results: []sarifResult{}}
+	run.Tool.Driver.Name = "RefViz"
+	run.Tool.Driver.Rules = []sarifRule{rule}
+	for _, p := range packages {
+		for _, s := range p.Symbols {
+			var loc sarifLocation
+			// uris are relative to the root of the project
+			loc.PhysicalLocation.ArtifactLocation.URI = filepath.ToSlash(s.RelPath)
+			loc.PhysicalLocation.ArtifactLocation.URIBaseID = "%SRCROOT%"
+			loc.PhysicalLocation.Region.StartLine = s.Line
+			loc.PhysicalLocation.Region.StartColumn = s.Column
+			run.Results = append(run.Results, sarifResult{
+				RuleID:    rule.ID,
+				Level:     "warning",
+				Message:   sarifMessage{Text: fmt.Sprintf("%s %s: %s", s.Kind, s.ID, rule.ShortDescription.Text)},
+				Locations: []sarifLocation{loc},
+			})
+		}
+	}
+	return sarif{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}
+}
@@ -1,29 +1,60 @@
 package ops
 
 import (
+	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"sort"
+
+	"github.com/JoachimTislov/RefViz/internal"
+	"github.com/JoachimTislov/RefViz/lsp"
 )
 
 // checks if the directory or file is valid
 func isValid(isDir bool, content string) bool {
-	exDirs, exFiles, inExt := getContentFilters()
-	name := filepath.Base(content)
-	if isDir {
-		if exDirs[name] {
-			return false
-		}
-	} else {
-		if exFiles[name] {
-			return false
-		}
-		e := filepath.Ext(name)
-		if !inExt[e] {
-			return false
+	return skipReason(isDir, content) == ""
+}
+
+// skip checks if the directory or file is filtered out, and logs why if -explain is set
+// Files skipped for their extension are not logged, as they are most of the files in a project
+func skip(isDir bool, content string) bool {
+	if !isDir && !includedExt(content) {
+		return true
+	}
+	reason := skipReason(isDir, content)
+	if reason != "" && explain {
+		log.Printf("Skipped %s: %s\n", content, reason)
+	}
+	return reason != ""
+}
+
+// skipReason returns why the directory or file is filtered out, or an empty string if it is valid
+// Relative paths are relative to the project
+func skipReason(isDir bool, content string) string {
+	if !filepath.IsAbs(content) {
+		content = filepath.Join(internal.ProjectPath(), content)
+	}
+	if !isDir && !includedExt(content) {
+		return fmt.Sprintf("the extension %q is not in includedExtensions", filepath.Ext(content))
+	}
+	if reason := ignore.Match(content, isDir); reason != "" || isDir {
+		return reason
+	}
+	if config.Generated == generatedSkip && isGenerated(content) {
+		return "generated file, generated is skip in the config"
+	}
+	if filepath.Ext(content) == goExt {
+		if ok, err := lsp.MatchFile(content); err == nil && !ok {
+			return fmt.Sprintf("excluded by build constraints for %s", lsp.BuildTarget())
 		}
-		// bools are initialized to false, so no need to set it to false
 	}
-	return true
+	return ""
+}
+
+func includedExt(content string) bool {
+	_, _, inExt := getContentFilters()
+	return inExt[filepath.Ext(content)]
 }
 
 // checks if the content is valid
@@ -34,3 +65,23 @@ func checkIfValid(content string) (os.FileInfo, bool) {
 	}
 	return c, isValid(c.IsDir(), content)
 }
+
+// loadIgnore reads the ignore files of the project lazily, after the excluded directories and files of the config
+// The entries of the config are gitignore patterns, directories only match directories
+func loadIgnore() {
+	exDirs, exFiles, _ := getContentFilters()
+	ignore = internal.NewIgnore(internal.ProjectPath())
+	ignore.Add("config excludedDirectories", sortedPatterns(exDirs, "/")...)
+	ignore.Add("config excludedFiles", sortedPatterns(exFiles, "")...)
+}
+
+func sortedPatterns(m map[string]bool, suffix string) []string {
+	var patterns []string
+	for p, ok := range m {
+		if ok {
+			patterns = append(patterns, p+suffix)
+		}
+	}
+	sort.Strings(patterns)
+	return patterns
+}
@@ -0,0 +1,213 @@
+package ops
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/JoachimTislov/RefViz/internal"
+	"github.com/JoachimTislov/RefViz/lsp"
+)
+
+const (
+	pollInterval = 500 * time.Millisecond
+	// debounce is the time without changes before the changed files are scanned
+	// Saving several files, or a formatter rewriting a file, results in one update
+	debounce = time.Second
+)
+
+type fileState struct {
+	modTime int64
+	size    int64
+}
+
+// Watch polls the project for changed files, scans them and updates the maps containing them
+// onUpdate is called with the name of every updated map, e.g. to regenerate its graphviz file
+func Watch(ctx context.Context, onUpdate func(mapName *string) error) error {
+	prev, err := snapshot()
+	if err != nil {
+		return fmt.Errorf("error walking project: %v", err)
+	}
+	log.Println("Watching for changes, press Ctrl+C to stop")
+
+	pending := make(map[string]bool)
+	var lastChange time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(pollInterval):
+		}
+		current, err := snapshot()
+		if err != nil {
+			return fmt.Errorf("error walking project: %v", err)
+		}
+		for path, state := range current {
+			if old, ok := prev[path]; !ok || old != state {
+				pending[path] = true
+				lastChange = time.Now()
+			}
+		}
+		for path := range prev {
+			if _, ok := current[path]; !ok {
+				pending[path] = true
+				lastChange = time.Now()
+			}
+		}
+		prev = current
+
+		if len(pending) == 0 || time.Since(lastChange) < debounce {
+			continue
+		}
+		if err := update(ctx, pending, onUpdate); err != nil {
+			log.Printf("Error updating changed files: %v\n", err)
+		}
+		pending = make(map[string]bool)
+	}
+}
+
+// snapshot returns the state of the files in the project, filtered by the extensions and ignore rules of the config
+func snapshot() (map[string]fileState, error) {
+	files := make(map[string]fileState)
+	tempFolder := internal.GetTempFolderPath()
+	err := filepath.WalkDir(internal.ProjectPath(), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path == tempFolder || !isValid(true, path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// the content of changed files is checked by update, a file may gain or lose the generated comment
+		if !includedExt(path) || ignore.Match(path, false) != "" {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			// removed while walking
+			return nil
+		}
+		files[path] = fileState{modTime: info.ModTime().UnixNano(), size: info.Size()}
+		return nil
+	})
+	return files, err
+}
+
+// update scans the changed files and the references into them, and updates the maps containing any of the scanned or removed files
+// The cache entries of removed files are collected, and the symbols referenced in them are scanned again
+func update(ctx context.Context, changed map[string]bool, onUpdate func(mapName *string) error) error {
+	var files []string
+	var removed bool
+	for path := range changed {
+		// the backends answer from the content they read before the change otherwise
+		if err := lsp.Changed(ctx, path); err != nil {
+			return fmt.Errorf("error updating backend: %s, err: %v", path, err)
+		}
+		forgetTestPackage(path)
+		forgetGenerated(path)
+		if !internal.Exists(path) {
+			log.Printf("Removed file: %s\n", path)
+			removed = true
+		} else if reason := skipReason(false, path); reason != "" {
+			// e.g. a file which gained the generated comment, its entry is collected like the one of a removed file
+			log.Printf("Skipped changed file: %s, %s\n", path, reason)
+			removed = true
+		} else {
+			files = append(files, path)
+		}
+	}
+	if removed {
+		collect()
+	}
+	log.Printf("Scanning %d changed files\n", len(files))
+
+	if err := invalidate(files); err != nil {
+		return fmt.Errorf("error invalidating references: %v", err)
+	}
+	scanned := make(map[string]bool, len(changed))
+	for path := range changed {
+		scanned[path] = true
+	}
+	for _, relPath := range cache.StaleEntries() {
+		scanned[filepath.Join(internal.ProjectPath(), relPath)] = true
+	}
+	var everythingIsUpToDate atomic.Bool
+	everythingIsUpToDate.Store(true)
+	if err := scanFiles(ctx, files, false, &everythingIsUpToDate); err != nil {
+		return checkpoint(ctx, fmt.Errorf("error scanning files: %v", err))
+	}
+	if err := scanStale(ctx, &everythingIsUpToDate); err != nil {
+		return checkpoint(ctx, fmt.Errorf("error scanning stale references: %v", err))
+	}
+
+	if err := saveCache(); err != nil {
+		return fmt.Errorf("error saving cache: %v", err)
+	}
+	if err := report(); err != nil {
+		log.Println(err)
+	}
+
+	maps, err := getMaps()
+	if err != nil {
+		return fmt.Errorf("error getting maps: %v", err)
+	}
+	for _, name := range maps {
+		updated, err := updateMap(ctx, name, scanned)
+		if err != nil {
+			return fmt.Errorf("error updating map: %s, err: %v", *name, err)
+		}
+		if !updated {
+			continue
+		}
+		log.Printf("Updated map: %s\n", *name)
+		if err := onUpdate(name); err != nil {
+			return fmt.Errorf("error updating map: %s, err: %v", *name, err)
+		}
+	}
+	return nil
+}
+
+// updateMap adds the files of the map again, if it contains any of the scanned files
+// The nodes are cleared first, so references which no longer exist are removed
+func updateMap(ctx context.Context, name *string, scanned map[string]bool) (bool, error) {
+	rMap, err := LoadMap(name)
+	if err != nil {
+		return false, err
+	}
+	files := make(map[string][]string)
+	var contains bool
+	for nodeName, node := range rMap.Nodes {
+		files[nodeName] = node.AddedFiles(internal.ProjectPath())
+		for _, path := range files[nodeName] {
+			contains = contains || scanned[path]
+		}
+	}
+	if !contains {
+		return false, nil
+	}
+
+	forceUpdate := true
+	for nodeName, node := range rMap.Nodes {
+		node.Clear()
+		for _, path := range files[nodeName] {
+			if !internal.Exists(path) {
+				continue
+			}
+			if err := addFileToFolder(ctx, path, node.RootFolder, &forceUpdate); err != nil {
+				return false, fmt.Errorf("error adding file to folder: %v", err)
+			}
+		}
+	}
+	rMap.CreateMissingSymbols(internal.ProjectPath())
+
+	if err := marshalAndWriteToFile(rMap, internal.GetMapPath(rMap.Name)); err != nil {
+		return false, fmt.Errorf("error writing to file: %v", err)
+	}
+	return true, nil
+}
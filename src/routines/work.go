@@ -1,48 +1,144 @@
 package routines
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"runtime"
 	"sync"
 )
 
-func StartWork(workers int, jobs []func() error) error {
-	var wg sync.WaitGroup
-	l := len(jobs)
-	jobCh := make(chan func() error, l)
-	ch := make(chan error, l)
+// Priority decides the order of queued jobs, jobs with a higher priority are started first
+type Priority int
+
+const (
+	// High is used for symbol jobs, which create the reference jobs
+	High Priority = iota
+	// Low is used for reference jobs
+	Low
+)
+
+// Progress is passed to the progress callback when a job is done
+// Total grows while jobs submit new jobs
+type Progress struct {
+	Name  string
+	Err   error
+	Done  int
+	Total int
+}
+
+type job struct {
+	name string
+	fn   func() error
+}
 
+// Scheduler runs the jobs of the whole project with a limited number of workers
+// Jobs may submit new jobs, Run returns when every submitted job is done
+type Scheduler struct {
+	workers    int
+	OnProgress func(Progress)
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queues  [Low + 1][]job
+	running int
+	done    int
+	total   int
+	errs    []error
+}
+
+// NewScheduler creates a scheduler running at most workers jobs at once, the number of CPUs if workers is less than 1
+func NewScheduler(workers int) *Scheduler {
 	if workers < 1 {
 		workers = runtime.NumCPU()
 	}
+	s := &Scheduler{workers: workers}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
 
-	wg.Add(workers)
-	for i := 0; i < workers; i++ {
+// Submit queues the job, safe to call from running jobs
+func (s *Scheduler) Submit(p Priority, name string, fn func() error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queues[p] = append(s.queues[p], job{name: name, fn: fn})
+	s.total++
+	s.cond.Signal()
+}
+
+// Run starts the workers and waits for the jobs to finish
+// Queued jobs are dropped when the context is done, the running ones finish
+// Returns the errors of the jobs joined, or the error of the context
+func (s *Scheduler) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	wg.Add(s.workers)
+	for i := 0; i < s.workers; i++ {
 		go func() {
 			defer wg.Done()
-			for job := range jobCh {
-				if err := job(); err != nil {
-					ch <- fmt.Errorf("error running job %d: %v", i, err)
-				}
-			}
+			s.work(ctx)
 		}()
 	}
+	wg.Wait()
 
-	for _, j := range jobs {
-		jobCh <- j
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := errors.Join(s.errs...)
+	s.errs = nil
+	if err == nil {
+		err = ctx.Err()
 	}
-	close(jobCh)
+	return err
+}
+
+func (s *Scheduler) work(ctx context.Context) {
+	for {
+		s.mu.Lock()
+		j, ok := s.next(ctx)
+		if !ok {
+			s.mu.Unlock()
+			return
+		}
+		s.running++
+		s.mu.Unlock()
 
-	go func() {
-		wg.Wait()
-		close(ch)
-	}()
+		err := j.fn()
 
-	for err := range ch {
+		s.mu.Lock()
+		s.running--
+		s.done++
 		if err != nil {
-			return err
+			s.errs = append(s.errs, err)
+		}
+		progress := Progress{Name: j.name, Err: err, Done: s.done, Total: s.total}
+		// waiting workers either take the jobs submitted by this job, or stop if everything is done
+		s.cond.Broadcast()
+		s.mu.Unlock()
+
+		if s.OnProgress != nil {
+			s.OnProgress(progress)
 		}
 	}
+}
 
-	return nil
+// next waits for a queued job, it returns false when no job is queued or running
+// Must be called with the lock held
+func (s *Scheduler) next(ctx context.Context) (job, bool) {
+	for {
+		if ctx.Err() != nil {
+			for p := range s.queues {
+				s.total -= len(s.queues[p])
+				s.queues[p] = nil
+			}
+		}
+		for p := range s.queues {
+			if len(s.queues[p]) > 0 {
+				j := s.queues[p][0]
+				s.queues[p] = s.queues[p][1:]
+				return j, true
+			}
+		}
+		if s.running == 0 {
+			return job{}, false
+		}
+		s.cond.Wait()
+	}
 }
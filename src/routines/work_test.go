@@ -0,0 +1,60 @@
+package routines
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestScheduler(t *testing.T) {
+	s := NewScheduler(1)
+	var order []string
+	var progress []Progress
+	s.OnProgress = func(p Progress) { progress = append(progress, p) }
+
+	s.Submit(Low, "ref", func() error {
+		order = append(order, "ref")
+		return errors.New("ref failed")
+	})
+	s.Submit(High, "symbols", func() error {
+		order = append(order, "symbols")
+		// submitted jobs run before Run returns
+		s.Submit(Low, "nested", func() error {
+			order = append(order, "nested")
+			return errors.New("nested failed")
+		})
+		return nil
+	})
+
+	err := s.Run(context.Background())
+	if got := strings.Join(order, ","); got != "symbols,ref,nested" {
+		t.Errorf("expected order symbols,ref,nested, got %s", got)
+	}
+	if err == nil || !strings.Contains(err.Error(), "ref failed") || !strings.Contains(err.Error(), "nested failed") {
+		t.Errorf("expected both errors, got %v", err)
+	}
+	if last := progress[len(progress)-1]; len(progress) != 3 || last.Done != 3 || last.Total != 3 {
+		t.Errorf("expected 3 of 3 jobs done, got %+v", progress)
+	}
+}
+
+func TestSchedulerCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := NewScheduler(1)
+	var ran int
+	for range 3 {
+		s.Submit(High, "job", func() error {
+			ran++
+			cancel()
+			return nil
+		})
+	}
+	if err := s.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context canceled, got %v", err)
+	}
+	if ran != 1 {
+		t.Errorf("expected queued jobs to be dropped, %d jobs ran", ran)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package store
+
+import "os"
+
+// lockFile is a no-op on platforms without flock, the cache is still written atomically
+func lockFile(f *os.File) error {
+	return nil
+}
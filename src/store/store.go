@@ -0,0 +1,326 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JoachimTislov/RefViz/types"
+)
+
+// flushInterval is the minimum time between flushes of buffered updates
+const flushInterval = 10 * time.Second
+
+// Store persists the cache, buffering updates of entries until they are flushed
+// Files are replaced atomically, so readers never see a partial file
+// Load takes an advisory lock before reading, held until Close, so two processes do not work on the same snapshot
+// and overwrite each others updates
+type Store struct {
+	path  string
+	dir   string
+	shard bool
+	cache *types.Cache
+
+	mu        sync.Mutex
+	dirty     map[string]bool
+	all       bool
+	lastFlush time.Time
+	lock      *os.File
+	// written is true once the cache is saved, Close only flushes caches which are written
+	written bool
+}
+
+// New creates a store for the cache at path
+// If shard is true, the entries are stored in one file per package directory next to it
+func New(path string, shard bool, cache *types.Cache) *Store {
+	return &Store{
+		path:      path,
+		dir:       filepath.Join(filepath.Dir(path), "cache"),
+		shard:     shard,
+		cache:     cache,
+		dirty:     make(map[string]bool),
+		lastFlush: time.Now(),
+	}
+}
+
+// Load locks the cache and reads it, including the shards if there are any, and migrates it to the current version
+// A second process fails here, before doing any work
+// Returns a types.SchemaError if it can not be migrated
+func (s *Store) Load() error {
+	s.mu.Lock()
+	err := s.acquire()
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	// shards are written before the main file, they have the current version if the first flush was interrupted
+	version := types.CacheVersion
+	bytes, err := os.ReadFile(s.path)
+	if err == nil {
+		if version, err = types.Decode(types.CacheSchema, bytes, s.cache); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("error reading file: %s, err: %v", s.path, err)
+	}
+	if s.cache.Entries == nil {
+		s.cache.Entries = make(map[string]types.CacheEntry)
+	}
+	shards, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error reading cache shards: %v", err)
+	}
+	for _, shard := range shards {
+		path := filepath.Join(s.dir, shard.Name())
+		bytes, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("error reading file: %s, err: %v", path, err)
+		}
+		// shards have the version of the main file, and are migrated as its entries
+		var entries map[string]any
+		if err := json.Unmarshal(bytes, &entries); err != nil {
+			return &types.SchemaError{Schema: types.CacheSchema, Version: version, Err: err}
+		}
+		data, err := json.Marshal(map[string]any{"version": version, "entries": entries})
+		if err != nil {
+			return fmt.Errorf("error marshalling cache shard: %v", err)
+		}
+		var shardCache struct {
+			Entries map[string]types.CacheEntry `json:"entries"`
+		}
+		if _, err := types.Decode(types.CacheSchema, data, &shardCache); err != nil {
+			return err
+		}
+		for relPath, entry := range shardCache.Entries {
+			s.cache.Entries[relPath] = entry
+		}
+	}
+	return nil
+}
+
+// Reset removes the cache files and the content of the cache, so it is built again
+func (s *Store) Reset() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.RemoveAll(s.dir); err != nil {
+		return fmt.Errorf("error removing cache shards: %v", err)
+	}
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing cache: %v", err)
+	}
+	s.cache.Reset()
+	s.dirty = make(map[string]bool)
+	s.all = false
+	return nil
+}
+
+// Update marks the entry as changed, it is written by the next flush
+func (s *Store) Update(relPath string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dirty[shardOf(relPath)] = true
+}
+
+// UpdateAll marks every entry as changed
+func (s *Store) UpdateAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.all = true
+}
+
+// Save flushes the buffered updates if the last flush is older than the flush interval
+func (s *Store) Save() error {
+	s.mu.Lock()
+	if err := s.acquire(); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	s.written = true
+	due := time.Since(s.lastFlush) >= flushInterval
+	s.mu.Unlock()
+	if !due {
+		return nil
+	}
+	return s.Flush()
+}
+
+// Flush writes the cache, only the changed shards are written if the cache is sharded
+func (s *Store) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.acquire(); err != nil {
+		return err
+	}
+	s.written = true
+	s.cache.Mu.Lock()
+	defer s.cache.Mu.Unlock()
+
+	if s.shard {
+		if err := s.writeShards(); err != nil {
+			return err
+		}
+	}
+	// the entries are left out of the main file, if they are stored in shards
+	entries := s.cache.Entries
+	if s.shard {
+		s.cache.Entries = nil
+	}
+	bytes, err := json.Marshal(s.cache)
+	s.cache.Entries = entries
+	if err != nil {
+		return fmt.Errorf("error marshalling cache: %v", err)
+	}
+	if err := WriteFile(s.path, bytes); err != nil {
+		return err
+	}
+	s.dirty = make(map[string]bool)
+	s.all = false
+	s.lastFlush = time.Now()
+	return nil
+}
+
+// writeShards writes the changed shards, must be called with the cache locked
+func (s *Store) writeShards() error {
+	shards := make(map[string]map[string]types.CacheEntry)
+	for relPath, entry := range s.cache.Entries {
+		shard := shardOf(relPath)
+		if !s.all && !s.dirty[shard] {
+			continue
+		}
+		if shards[shard] == nil {
+			shards[shard] = make(map[string]types.CacheEntry)
+		}
+		shards[shard][relPath] = entry
+	}
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("error creating cache directory: %v", err)
+	}
+	if err := s.removeShards(shards); err != nil {
+		return err
+	}
+	for shard, entries := range shards {
+		bytes, err := json.Marshal(entries)
+		if err != nil {
+			return fmt.Errorf("error marshalling cache shard: %s, err: %v", shard, err)
+		}
+		if err := WriteFile(s.shardPath(shard), bytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close flushes the buffered updates and releases the lock
+func (s *Store) Close() error {
+	s.mu.Lock()
+	changed := s.written
+	s.mu.Unlock()
+	var err error
+	if changed {
+		err = s.Flush()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lock != nil {
+		// the lock file is kept, removing it could let two processes lock different files
+		s.lock.Close()
+		s.lock = nil
+	}
+	return err
+}
+
+// acquire takes the lock if the store does not hold it, must be called with the store locked
+func (s *Store) acquire() error {
+	if s.lock != nil {
+		return nil
+	}
+	f, err := os.OpenFile(s.path+".lock", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return fmt.Errorf("error opening cache lock: %v", err)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return fmt.Errorf("the cache is used by another RefViz process, wait for it to finish: %v", err)
+	}
+	s.lock = f
+	return nil
+}
+
+// removeShards removes the files of the changed shards whose entries were all removed
+// All shard files without entries are removed if every entry changed
+func (s *Store) removeShards(shards map[string]map[string]types.CacheEntry) error {
+	paths := make(map[string]bool)
+	for shard := range shards {
+		paths[s.shardPath(shard)] = true
+	}
+	var remove []string
+	if s.all {
+		files, err := os.ReadDir(s.dir)
+		if err != nil {
+			return fmt.Errorf("error reading cache shards: %v", err)
+		}
+		for _, f := range files {
+			if !strings.HasPrefix(f.Name(), "pkg_") {
+				continue
+			}
+			remove = append(remove, filepath.Join(s.dir, f.Name()))
+		}
+	} else {
+		for shard := range s.dirty {
+			remove = append(remove, s.shardPath(shard))
+		}
+	}
+	for _, path := range remove {
+		if paths[path] {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing cache shard: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) shardPath(shard string) string {
+	return filepath.Join(s.dir, fmt.Sprintf("pkg_%s.json", url.QueryEscape(shard)))
+}
+
+// shardOf returns the package directory of the file, the project root is an empty string
+func shardOf(relPath string) string {
+	dir := filepath.ToSlash(filepath.Dir(relPath))
+	return strings.TrimPrefix(dir, ".")
+}
+
+// WriteFile replaces the file atomically, by writing a temporary file in the same directory and renaming it
+func WriteFile(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("error creating temporary file: %s, err: %v", path, err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("error when writing to file: %s, err: %v", path, err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("error syncing file: %s, err: %v", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error closing file: %s, err: %v", path, err)
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		return fmt.Errorf("error setting file mode: %s, err: %v", path, err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("error replacing file: %s, err: %v", path, err)
+	}
+	return nil
+}
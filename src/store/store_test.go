@@ -0,0 +1,45 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/JoachimTislov/RefViz/types"
+)
+
+func TestRemovedShards(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	cache := types.NewCache()
+	cache.AddEntry("a/a.go", &types.CacheEntry{Name: "a.go"})
+	cache.AddEntry("b/b.go", &types.CacheEntry{Name: "b.go"})
+	s := New(path, true, cache)
+	s.UpdateAll()
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the entries of b are removed and everything is written again, like -gc does
+	cache.Remove(map[string]bool{"b/b.go": true})
+	s.UpdateAll()
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// the shards are loaded without the main file
+	loaded := types.NewCache()
+	s = New(path, true, loaded)
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, ok := loaded.Entries["a/a.go"]; !ok {
+		t.Error("expected the entry of a to be loaded from its shard")
+	}
+	if _, ok := loaded.Entries["b/b.go"]; ok {
+		t.Error("expected the shard of the removed entries to be removed")
+	}
+}
@@ -1,11 +1,14 @@
 package types
 
 import (
+	"path/filepath"
+	"strings"
 	"sync"
 )
 
 func NewCache() *Cache {
 	return &Cache{
+		Version:       CacheVersion,
 		Errors:        []string{},
 		UnusedSymbols: make(map[string]map[string]UnusedSymbol),
 		Entries:       make(map[string]CacheEntry),
@@ -31,11 +34,118 @@ func (c *Cache) LogError(command string) {
 	c.Errors = append(c.Errors, command)
 }
 
+// AddUnfinished adds the file to the files of the scan which are not done
+func (c *Cache) AddUnfinished(relPath string) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	if c.Unfinished == nil {
+		c.Unfinished = make(map[string]bool)
+	}
+	c.Unfinished[relPath] = true
+}
+
+func (c *Cache) FinishFile(relPath string) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	delete(c.Unfinished, relPath)
+}
+
+func (c *Cache) UnfinishedFiles() []string {
+	c.Mu.RLock()
+	defer c.Mu.RUnlock()
+
+	var paths []string
+	for p := range c.Unfinished {
+		paths = append(paths, p)
+	}
+	return paths
+}
+
+// Remove drops the entries and the references from other entries located in their files
+// Symbols left without references are marked as stale, to be confirmed as unused by the next scan
+// Returns the number of removed references and stale symbols
+func (c *Cache) Remove(relPaths map[string]bool) (int, int) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	for relPath := range relPaths {
+		delete(c.Entries, relPath)
+		delete(c.UnusedSymbols, relPath)
+		delete(c.Unfinished, relPath)
+	}
+	var refs, stale int
+	for _, entry := range c.Entries {
+		for _, s := range entry.Symbols {
+			n := removeRefs(s.Refs, relPaths) + removeRefs(s.Implementations, relPaths)
+			if n > 0 && len(s.Refs) == 0 {
+				s.Stale = true
+				stale++
+			}
+			refs += n
+		}
+	}
+	for relPath := range c.UnusedSymbols {
+		if _, ok := c.Entries[relPath]; !ok {
+			delete(c.UnusedSymbols, relPath)
+		}
+	}
+	// references located in the removed files are gone
+	for relPath := range relPaths {
+		delete(c.Index, relPath)
+	}
+	for _, entries := range c.Index {
+		for relPath := range relPaths {
+			delete(entries, relPath)
+		}
+	}
+	return refs, stale
+}
+
+func removeRefs(refs map[string]*Ref, relPaths map[string]bool) int {
+	var n int
+	for key, ref := range refs {
+		if relPaths[ref.FilePath] {
+			delete(refs, key)
+			n++
+		}
+	}
+	return n
+}
+
+// Reset removes the content of the cache, so it is built again
+func (c *Cache) Reset() {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	c.Version = CacheVersion
+	c.Commit = ""
+	c.Errors = []string{}
+	c.Unfinished = nil
+	c.UnusedSymbols = make(map[string]map[string]UnusedSymbol)
+	c.Entries = make(map[string]CacheEntry)
+	c.Index = nil
+}
+
+// TakeErrors returns the logged errors and removes them from the cache
+func (c *Cache) TakeErrors() []string {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	errors := c.Errors
+	c.Errors = []string{}
+	return errors
+}
+
 func (c *Cache) AddEntry(relPath string, entry *CacheEntry) {
 	c.Mu.Lock()
 	defer c.Mu.Unlock()
 
 	c.Entries[relPath] = *entry
+	if c.Index != nil {
+		c.indexEntry(relPath, entry)
+	}
 }
 
 func (c *Cache) GetEntry(relPath string) *CacheEntry {
@@ -48,21 +158,145 @@ func (c *Cache) GetEntry(relPath string) *CacheEntry {
 	return &CacheEntry{Symbols: make(map[string]*Symbol)}
 }
 
-func (c *Cache) AddUnusedSymbol(relPath string, name string, symbol UnusedSymbol) {
+func (c *Cache) HasEntry(relPath string) bool {
+	c.Mu.RLock()
+	defer c.Mu.RUnlock()
+
+	_, ok := c.Entries[relPath]
+	return ok
+}
+
+// Invalidate marks the symbols of other entries affected by a change to the file as stale
+// Symbols are affected if they are referenced or implemented in the file, where the old references are looked up in the index,
+// or if their name is one of the names found in the new content of the file and they are declared in one of the packages,
+// the package directories relative to the project the file can use. Names match the symbols of every package if packages is nil
+// Returns the number of symbols marked as stale
+func (c *Cache) Invalidate(relPath string, names, packages map[string]bool) int {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	if c.Index == nil {
+		c.Index = make(map[string]map[string]bool)
+		for p, entry := range c.Entries {
+			c.indexEntry(p, &entry)
+		}
+	}
+	var n int
+	for p, entry := range c.Entries {
+		if p == relPath {
+			continue
+		}
+		referenced := c.Index[relPath][p]
+		reachable := packages == nil || packages[filepath.Dir(p)]
+		for id, s := range entry.Symbols {
+			if s.Stale || !(reachable && names[s.Name]) && !(referenced && s.referencedIn(relPath)) {
+				continue
+			}
+			s.Stale = true
+			n++
+			// the interface of the method may have gained or lost an implementation
+			if i, ok := entry.Symbols[interfaceID(id)]; ok && !i.Stale {
+				i.Stale = true
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// indexEntry adds the files the symbols of the entry are referenced in to the index
+func (c *Cache) indexEntry(relPath string, entry *CacheEntry) {
+	for _, s := range entry.Symbols {
+		for _, refs := range []map[string]*Ref{s.Refs, s.Implementations} {
+			for _, ref := range refs {
+				if c.Index[ref.FilePath] == nil {
+					c.Index[ref.FilePath] = make(map[string]bool)
+				}
+				c.Index[ref.FilePath][relPath] = true
+			}
+		}
+	}
+}
+
+// StaleEntries returns the entries with symbols whose references must be scanned again
+func (c *Cache) StaleEntries() []string {
+	c.Mu.RLock()
+	defer c.Mu.RUnlock()
+
+	var paths []string
+	for p, entry := range c.Entries {
+		for _, s := range entry.Symbols {
+			if s.Stale {
+				paths = append(paths, p)
+				break
+			}
+		}
+	}
+	return paths
+}
+
+// IsScanned reports whether the references of the symbol are scanned
+// Symbols cached before Scanned was added are scanned if they have references or none
+func (s *Symbol) IsScanned() bool {
+	return s.Scanned || s.ZeroRefs || len(s.Refs) > 0
+}
+
+func (s *Symbol) referencedIn(relPath string) bool {
+	for _, refs := range []map[string]*Ref{s.Refs, s.Implementations} {
+		for _, ref := range refs {
+			if ref.FilePath == relPath {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// interfaceID returns the id of the interface declaring the method, if the id belongs to a method
+func interfaceID(id string) string {
+	id, ok := strings.CutSuffix(id, "#Method")
+	if !ok {
+		return ""
+	}
+	if i := strings.LastIndex(id, "."); i > 0 {
+		return id[:i] + "#Interface"
+	}
+	return ""
+}
+
+func (c *Cache) RemoveUnusedSymbol(relPath string, id string) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	delete(c.UnusedSymbols[relPath], id)
+	if len(c.UnusedSymbols[relPath]) == 0 {
+		delete(c.UnusedSymbols, relPath)
+	}
+}
+
+func (c *Cache) AddUnusedSymbol(relPath string, id string, symbol UnusedSymbol) {
 	c.Mu.Lock()
 	defer c.Mu.Unlock()
 
 	if c.UnusedSymbols[relPath] == nil {
 		c.UnusedSymbols[relPath] = make(map[string]UnusedSymbol)
 	}
-	c.UnusedSymbols[relPath][name] = symbol
+	c.UnusedSymbols[relPath][id] = symbol
 }
 
 type Cache struct {
-	Errors        []string                           `json:"errors,omitempty"`
+	Version int `json:"version"`
+	// Commit is the git commit the whole project was last scanned at
+	Commit string   `json:"commit,omitempty"`
+	Errors []string `json:"errors,omitempty"`
+	// Unfinished are the files of an interrupted scan, resumed by the next scan
+	Unfinished    map[string]bool                    `json:"unfinished,omitempty"`
 	UnusedSymbols map[string]map[string]UnusedSymbol `json:"UnusedSymbols,omitempty"`
 	Entries       map[string]CacheEntry              `json:"entries,omitempty"`
 	Mu            sync.RWMutex                       `json:"mu,omitempty"`
+	// Index maps the files references are located in to the entries of the referenced symbols
+	// Built on the first invalidation and kept up to date after, it may contain files which no longer reference the entry
+	Index map[string]map[string]bool `json:"index,omitempty"`
 }
 
 type UnusedSymbol struct {
@@ -74,10 +308,13 @@ type UnusedSymbol struct {
 type CacheEntry struct {
 	Name    string             `json:"name,omitempty"`
 	ModTime int64              `json:"modTime,omitempty"`
+	Hash    string             `json:"hash,omitempty"` // sha256 of the content, compared when the modification time differs
 	Symbols map[string]*Symbol `json:"symbols,omitempty"`
 }
 
+// Symbol and Ref paths are relative to the project, so the cache can be used from any checkout of it
 type Symbol struct {
+	ID       string          `json:"id,omitempty"`
 	Name     string          `json:"name,omitempty"`
 	Kind     string          `json:"kind,omitempty"`
 	Position Position        `json:"position,omitempty"`
@@ -85,12 +322,22 @@ type Symbol struct {
 	FilePath string          `json:"filePath,omitempty"`
 	Refs     map[string]*Ref `json:"refs,omitempty"`
 	ZeroRefs bool            `json:"zeroRefs,omitempty"` // if true, the symbol has no references
+	Stale    bool            `json:"stale,omitempty"`    // if true, the references must be scanned again
+	// Scanned is true once the references are scanned, also if none of them are located in a symbol and none are stored
+	Scanned bool `json:"scanned,omitempty"`
+	// Implementations are the types implementing the symbol, if it is an interface
+	Implementations map[string]*Ref `json:"implementations,omitempty"`
 }
 
+// Ref is a single occurrence of a reference, symbols keep every occurrence keyed by Path
 type Ref struct {
 	FilePath   string `json:"filepath,omitempty"`
-	Path       string `json:"path,omitempty"`
+	Path       string `json:"path,omitempty"` // file:line:startColumn-endColumn
+	Line       int    `json:"line,omitempty"`
+	Column     int    `json:"column,omitempty"`
 	FolderName string `json:"folderName,omitempty"`
 	FileName   string `json:"fileName,omitempty"`
 	MethodName string `json:"methodName,omitempty"`
+	// SymbolID is the id of the symbol containing the reference, see SymbolID
+	SymbolID string `json:"symbolId,omitempty"`
 }
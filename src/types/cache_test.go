@@ -0,0 +1,44 @@
+package types
+
+import "testing"
+
+func TestInvalidate(t *testing.T) {
+	c := NewCache()
+	c.AddEntry("a.go", &CacheEntry{Symbols: map[string]*Symbol{
+		"Foo#Function": {Name: "Foo", Refs: map[string]*Ref{
+			"b.go:3:2-5": {FilePath: "b.go"},
+		}},
+		"Bar#Function": {Name: "Bar"},
+		"I#Interface":  {Name: "I"},
+		"I.Run#Method": {Name: "Run"},
+	}})
+	c.AddEntry("b.go", &CacheEntry{Symbols: map[string]*Symbol{
+		"Baz#Function": {Name: "Baz"},
+	}})
+	c.AddEntry("c/c.go", &CacheEntry{Symbols: map[string]*Symbol{
+		"c.Run#Function": {Name: "Run"},
+	}})
+
+	// Foo is referenced in b.go, Run is named in it and Baz is declared in it, b.go does not import c
+	if n := c.Invalidate("b.go", map[string]bool{"Run": true, "Baz": true}, map[string]bool{".": true}); n != 3 {
+		t.Errorf("expected 3 stale symbols, got %d", n)
+	}
+	symbols := c.Entries["a.go"].Symbols
+	for id, stale := range map[string]bool{"Foo#Function": true, "Bar#Function": false, "I#Interface": true, "I.Run#Method": true} {
+		if symbols[id].Stale != stale {
+			t.Errorf("expected %s to be stale: %t", id, stale)
+		}
+	}
+	if c.Entries["b.go"].Symbols["Baz#Function"].Stale {
+		t.Error("expected symbols of the changed file to be left as is")
+	}
+	if c.Entries["c/c.go"].Symbols["c.Run#Function"].Stale {
+		t.Error("expected symbols of packages the file can not reach to be left as is")
+	}
+	if !c.Index["b.go"]["a.go"] {
+		t.Error("expected the index to map b.go to a.go")
+	}
+	if paths := c.StaleEntries(); len(paths) != 1 || paths[0] != "a.go" {
+		t.Errorf("expected stale entries [a.go], got %v", paths)
+	}
+}
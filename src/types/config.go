@@ -2,9 +2,11 @@ package types
 
 func NewConfig() *Config {
 	return &Config{
+		Version: ConfigVersion,
 		InExt:   newSbMap(".go"),
 		ExDirs:  newSbMap("node_modules", ".git"),
 		ExFiles: newSbMap(),
+		Symbols: defaultSymbolRules(),
 	}
 }
 
@@ -21,9 +23,52 @@ func newSbMap(args ...string) SbMap {
 }
 
 type Config struct {
-	InExt   SbMap `json:"includedExtensions,omitempty"`
-	ExDirs  SbMap `json:"excludedDirectories,omitempty"`
-	ExFiles SbMap `json:"excludedFiles,omitempty"`
+	Version int `json:"version"`
+	// Root overrides the detected project root, relative to it
+	// The config, cache and maps stay in the storage folder of the detected root, the -root flag takes precedence
+	Root string `json:"root,omitempty"`
+	// Storage is the folder of the cache and maps, only read from the config in the refViz folder of the project, which stays there
+	// "repo" keeps them in the refViz folder, relative paths are relative to the project root
+	Storage string `json:"storage,omitempty"`
+	InExt   SbMap  `json:"includedExtensions,omitempty"`
+	ExDirs  SbMap  `json:"excludedDirectories,omitempty"`
+	ExFiles SbMap  `json:"excludedFiles,omitempty"`
+	// Backend used to find symbols and references in Go files, gopls or native
+	// gopls is used by default, native is used if gopls is not installed
+	Backend string `json:"backend,omitempty"`
+	// ShardCache stores the cache entries in one file per package directory, cache/ in the storage folder, instead of in cache.json
+	ShardCache bool `json:"shardCache,omitempty"`
+	// Symbols decide which symbols are scanned for references and added to maps, tests, init and main are excluded by default
+	Symbols SymbolRules `json:"symbols"`
+	// Generated decides how files with a "// Code generated ... DO NOT EDIT." comment are handled
+	// skip leaves them out, collapse scans them but shows each file as one symbol in maps, include is the default
+	Generated string `json:"generated,omitempty"`
+	// Build is the target the //go:build constraints of Go files are evaluated for
+	Build Build `json:"build,omitempty"`
+	// Roots are regular expressions matching the ids of symbols -unreachable starts from, besides main, init, tests and exported library symbols
+	// Example: ["web.Server.Handle.*#Method"]
+	Roots []string `json:"roots,omitempty"`
+	// LanguageServers are used for the files of other languages
+	LanguageServers []LanguageServer `json:"languageServers,omitempty"`
+}
+
+// LanguageServer is started with the command and queried over stdio
+// Example: {"name": "pyright", "command": ["pyright-langserver", "--stdio"], "languageId": "python", "extensions": [".py"]}
+type LanguageServer struct {
+	Name       string   `json:"name"`
+	Command    []string `json:"command"`
+	LanguageID string   `json:"languageId"`
+	Extensions []string `json:"extensions"`
+	// Markers are files in the root directory of a project, e.g. pyproject.toml
+	Markers []string `json:"markers,omitempty"`
+}
+
+// Build is a target of the Go build, empty values are the values of the host
+// Example: {"goos": "windows", "goarch": "arm64", "tags": ["integration"]}
+type Build struct {
+	GOOS   string   `json:"goos,omitempty"`
+	GOARCH string   `json:"goarch,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
 }
 
 type SbMap map[string]bool
@@ -0,0 +1,141 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// SymbolRules decide which symbols are scanned for references and added to maps
+// A symbol is skipped if it matches an exclude rule, or if there are include rules and it matches none of them
+type SymbolRules struct {
+	Include []SymbolRule `json:"include,omitempty"`
+	Exclude []SymbolRule `json:"exclude,omitempty"`
+}
+
+// SymbolRule matches a symbol if every condition which is set matches
+// Example: {"name": "^Get", "kinds": ["Method"], "files": ["*.pb.go"]}
+type SymbolRule struct {
+	// Name is a regular expression matching the name of the symbol
+	Name  string   `json:"name,omitempty"`
+	Kinds []string `json:"kinds,omitempty"`
+	// Files are globs matching the file name, or the path relative to the project if they contain a /
+	Files []string `json:"files,omitempty"`
+	// Visibility is exported or unexported
+	Visibility string `json:"visibility,omitempty"`
+}
+
+// UnmarshalJSON replaces the default rules, json would decode the rules into the elements of the default slices
+func (r *SymbolRules) UnmarshalJSON(data []byte) error {
+	type rules SymbolRules
+	var decoded rules
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*r = SymbolRules(decoded)
+	return nil
+}
+
+func defaultSymbolRules() SymbolRules {
+	return SymbolRules{Exclude: []SymbolRule{
+		{Name: "^Test"},
+		{Name: "^(init|main)$"},
+	}}
+}
+
+// SymbolFilter is the compiled form of the symbol rules
+type SymbolFilter struct {
+	include, exclude []symbolMatcher
+}
+
+type symbolMatcher struct {
+	SymbolRule
+	name *regexp.Regexp
+}
+
+// NewSymbolFilter compiles the rules, returns an error for invalid regular expressions, globs or visibilities
+func NewSymbolFilter(rules SymbolRules) (*SymbolFilter, error) {
+	f := &SymbolFilter{}
+	var err error
+	if f.include, err = compileRules(rules.Include); err != nil {
+		return nil, err
+	}
+	if f.exclude, err = compileRules(rules.Exclude); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func compileRules(rules []SymbolRule) ([]symbolMatcher, error) {
+	matchers := make([]symbolMatcher, 0, len(rules))
+	for _, r := range rules {
+		m := symbolMatcher{SymbolRule: r}
+		if r.Name != "" {
+			re, err := regexp.Compile(r.Name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid name in symbol rule: %s, err: %v", r.Name, err)
+			}
+			m.name = re
+		}
+		for _, glob := range r.Files {
+			if _, err := filepath.Match(glob, ""); err != nil {
+				return nil, fmt.Errorf("invalid file glob in symbol rule: %s, err: %v", glob, err)
+			}
+		}
+		if r.Visibility != "" && r.Visibility != Exported && r.Visibility != Unexported {
+			return nil, fmt.Errorf("invalid visibility in symbol rule: %s, expected %s or %s", r.Visibility, Exported, Unexported)
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers, nil
+}
+
+// Skip reports whether the symbol, declared in the file with the path relative to the project, is left out
+func (f *SymbolFilter) Skip(relPath string, s *Symbol) bool {
+	if f == nil {
+		return false
+	}
+	for _, m := range f.exclude {
+		if m.match(relPath, s) {
+			return true
+		}
+	}
+	if len(f.include) == 0 {
+		return false
+	}
+	for _, m := range f.include {
+		if m.match(relPath, s) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m symbolMatcher) match(relPath string, s *Symbol) bool {
+	if m.name != nil && !m.name.MatchString(s.Name) {
+		return false
+	}
+	if len(m.Kinds) > 0 && !slices.Contains(m.Kinds, s.Kind) {
+		return false
+	}
+	if m.Visibility != "" && (m.Visibility == Exported) != IsExported(s.Name) {
+		return false
+	}
+	if len(m.Files) == 0 {
+		return true
+	}
+	relPath = filepath.ToSlash(relPath)
+	for _, glob := range m.Files {
+		target := filepath.Base(relPath)
+		if strings.Contains(glob, "/") {
+			target = relPath
+		}
+		if ok, _ := filepath.Match(glob, target); ok {
+			return true
+		}
+	}
+	return false
+}
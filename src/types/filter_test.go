@@ -0,0 +1,49 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSymbolFilter(t *testing.T) {
+	f, err := NewSymbolFilter(SymbolRules{
+		Include: []SymbolRule{{Kinds: []string{"Function", "Method"}}},
+		Exclude: []SymbolRule{
+			{Name: "^Get", Files: []string{"*.pb.go"}},
+			{Files: []string{"internal/*"}, Visibility: Unexported},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		relPath string
+		symbol  Symbol
+		skip    bool
+	}{
+		{"qf/types.pb.go", Symbol{Name: "GetName", Kind: "Method"}, true},
+		{"qf/types.go", Symbol{Name: "GetName", Kind: "Method"}, false},
+		{"qf/types.pb.go", Symbol{Name: "Name", Kind: "Field"}, true},
+		{"internal/a.go", Symbol{Name: "helper", Kind: "Function"}, true},
+		{"internal/a.go", Symbol{Name: "Helper", Kind: "Function"}, false},
+		{"web/internal/a.go", Symbol{Name: "helper", Kind: "Function"}, false},
+	} {
+		if skip := f.Skip(test.relPath, &test.symbol); skip != test.skip {
+			t.Errorf("%s %s: expected skip %t, got %t", test.relPath, test.symbol.Name, test.skip, skip)
+		}
+	}
+
+	if _, err := NewSymbolFilter(SymbolRules{Exclude: []SymbolRule{{Name: "("}}}); err == nil {
+		t.Error("expected an error for an invalid name")
+	}
+}
+
+func TestSymbolRulesReplaceDefaults(t *testing.T) {
+	c := NewConfig()
+	if err := json.Unmarshal([]byte(`{"symbols": {"exclude": [{"files": ["*.pb.go"]}]}}`), c); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Symbols.Exclude) != 1 || c.Symbols.Exclude[0].Name != "" {
+		t.Errorf("expected the default rules to be replaced, got %+v", c.Symbols.Exclude)
+	}
+}
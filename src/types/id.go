@@ -0,0 +1,24 @@
+package types
+
+import "strings"
+
+// SymbolID identifies a symbol within the project
+// Names are only unique within their package, receiver and kind, e.g. two types in one file with a String method
+// Examples: web/hooks.GitHubWebHook.handlePush#Method, scm.SCM#Interface, qf.User.Name#Field
+func SymbolID(pkg, receiver, name, kind string) string {
+	parts := make([]string, 0, 3)
+	for _, p := range []string{pkg, receiver, name} {
+		if p != "" && p != "." {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, ".") + "#" + kind
+}
+
+// KindFromID returns the kind of the symbol, the part after the last #
+func KindFromID(id string) string {
+	if i := strings.LastIndex(id, "#"); i >= 0 {
+		return id[i+1:]
+	}
+	return ""
+}
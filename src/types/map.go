@@ -10,8 +10,9 @@ import (
 
 func NewMap(name *string) *RMap {
 	return &RMap{
-		Name:  *name,
-		Nodes: map[string]*Node{},
+		Version: MapVersion,
+		Name:    *name,
+		Nodes:   map[string]*Node{},
 	}
 }
 
@@ -28,18 +29,24 @@ func (f *Folder) createMissingSymbols(projectPath string) error {
 	var refs []SymbolRef
 	f.getRefs(&refs)
 	for _, ref := range refs {
-		folder, err := f.GetRelatedFolder(ref.Ref.FilePath, projectPath)
+		path := ref.Ref.FilePath
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(projectPath, path)
+		}
+		folder, err := f.GetRelatedFolder(path, projectPath)
 		if err != nil {
 			return fmt.Errorf("error getting related folder: %v", err)
 		}
-		name := ref.Ref.MethodName
+		id := ref.Ref.SymbolID
 		file := folder.GetFile(&ref.Ref.FileName, &folder.FolderPath)
-		if _, ok := file.Symbols[name]; !ok {
+		if _, ok := file.Symbols[id]; !ok {
 			if file.Symbols == nil {
 				(*file).Symbols = make(map[string]symbol)
 			}
-			(*file).Symbols[name] = symbol{
-				Name:     name,
+			(*file).Symbols[id] = symbol{
+				ID:       id,
+				Name:     ref.Ref.MethodName,
+				Kind:     KindFromID(id),
 				FilePath: ref.Ref.FilePath,
 			}
 		}
@@ -64,10 +71,13 @@ func (f *Folder) getRefs(refs *[]SymbolRef) {
 	}
 }
 
-func newNode(name, path string) *Node {
+// newNode creates a node whose root folder is the project, folder paths are relative to it
+func newNode(name, projectPath string) *Node {
+	root := newFolder(".")
+	root.FolderName = filepath.Base(projectPath)
 	return &Node{
 		Name:       name,
-		RootFolder: newFolder(path),
+		RootFolder: root,
 	}
 }
 
@@ -90,6 +100,40 @@ func (m *RMap) AddNode(nodeName *string, projectPath string) {
 	m.Nodes[*nodeName] = newNode(*nodeName, projectPath)
 }
 
+// AddedFiles returns the absolute paths of the files added to the node
+// Maps created before files were marked as added, return every file of the node
+func (n *Node) AddedFiles(projectPath string) []string {
+	var added, all []string
+	n.RootFolder.files(projectPath, &added, &all)
+	if len(added) == 0 {
+		return all
+	}
+	return added
+}
+
+func (f *Folder) files(projectPath string, added, all *[]string) {
+	for _, file := range f.Files {
+		path := filepath.Join(projectPath, file.Path, file.Name)
+		if filepath.IsAbs(file.Path) {
+			path = filepath.Join(file.Path, file.Name)
+		}
+		if file.Added {
+			*added = append(*added, path)
+		}
+		*all = append(*all, path)
+	}
+	for _, folder := range f.SubFolders {
+		folder.files(projectPath, added, all)
+	}
+}
+
+// Clear removes the content of the node, so it can be added again
+func (n *Node) Clear() {
+	root := newFolder(n.RootFolder.FolderPath)
+	root.FolderName = n.RootFolder.FolderName
+	n.RootFolder = root
+}
+
 func newFolder(path string) *Folder {
 	return &Folder{
 		FolderName: filepath.Base(path),
@@ -99,9 +143,9 @@ func newFolder(path string) *Folder {
 	}
 }
 
-func (f *File) AddSymbols(folderRefs *map[string]SymbolRef, symbols *map[string]*Symbol, fullFolderPath, fileName *string, force *bool) {
+func (f *File) AddSymbols(folderRefs *map[string]SymbolRef, symbols *map[string]*Symbol, folderPath, fileName *string, force *bool) {
 	for _, s := range *symbols {
-		f.AddSymbol(s.SortRefsIntoHierarchy(folderRefs, &f.Refs, fullFolderPath, fileName, force), force)
+		f.AddSymbol(s.SortRefsIntoHierarchy(folderRefs, &f.Refs, folderPath, fileName, force), force)
 	}
 }
 
@@ -109,57 +153,84 @@ func (f *File) AddSymbol(s Symbol, force *bool) {
 	if f.Symbols == nil {
 		f.Symbols = make(map[string]symbol)
 	}
-	if _, ok := f.Symbols[s.Name]; !ok || *force {
-		f.Symbols[s.Name] = s.createSymbol()
+	if _, ok := f.Symbols[s.ID]; !ok || *force {
+		f.Symbols[s.ID] = s.createSymbol()
 	} else {
 		//log.Printf("symbol: %s already exists in file: %s", s.Name, f.Name)
 	}
 }
 
-func (s *Symbol) newSymbolRef(ref *Ref) SymbolRef {
+func (s *Symbol) newSymbolRef(ref *Ref, relation string) SymbolRef {
 	return SymbolRef{
 		Definition: symbol{
+			ID:       s.ID,
 			Name:     s.Name,
 			Kind:     s.Kind,
 			FilePath: s.FilePath,
 		},
-		Ref: *ref,
+		Ref:      *ref,
+		Relation: relation,
 	}
 }
 
+// SortRefsIntoHierarchy returns a copy of the symbol with only the references located in its own file
+// The other references are aggregated into the folder or file maps, the cached symbol is left untouched
 func (s *Symbol) SortRefsIntoHierarchy(folderRefs, fileRefs *map[string]SymbolRef, folderPath, fileName *string, force *bool) Symbol {
 	if folderRefs == nil || fileRefs == nil {
 		log.Fatal("folderRefs or fileRefs is nil")
 	}
-	var refsToRemove []string
-	for key, r := range s.Refs {
-		sRef := s.newSymbolRef(r)
+	sorted := *s
+	sorted.Refs = sortIntoHierarchy(s, s.Refs, "", folderRefs, fileRefs, folderPath, fileName, force)
+	sorted.Implementations = sortIntoHierarchy(s, s.Implementations, Implements, folderRefs, fileRefs, folderPath, fileName, force)
+	return sorted
+}
 
+// sortIntoHierarchy moves the references located in other folders or files to their maps
+// Occurrences between the same two symbols become one edge, weighted by the number of occurrences
+func sortIntoHierarchy(s *Symbol, refs map[string]*Ref, relation string, folderRefs, fileRefs *map[string]SymbolRef, folderPath, fileName *string, force *bool) map[string]*Ref {
+	local := make(map[string]*Ref)
+	moved := make(map[string]SymbolRef)
+	targets := make(map[string]*map[string]SymbolRef)
+	for key, r := range refs {
 		folderPathDiffer := filepath.Dir(r.FilePath) != *folderPath
 		fileNameDiffer := r.FileName != *fileName
+		if !folderPathDiffer && !fileNameDiffer {
+			local[key] = r
+			continue
+		}
 		// if the reference is in a different folder or page, move it to the appropriate folder or file
-		// and remove it from the symbol
-		if folderPathDiffer || fileNameDiffer {
-			refsToRemove = append(refsToRemove, key)
-			refsPointer := fileRefs
-			if folderPathDiffer {
-				refsPointer = folderRefs
-			}
-			addEntryToMap(refsPointer, sRef.createSymbolMapKey(), sRef, force)
+		refsPointer := fileRefs
+		if folderPathDiffer {
+			refsPointer = folderRefs
 		}
+		sRef := s.newSymbolRef(r, relation)
+		addOccurrence(moved, sRef)
+		targets[sRef.createSymbolMapKey()] = refsPointer
 	}
-	for _, key := range refsToRemove {
-		delete(s.Refs, key)
+	for key, sRef := range moved {
+		addEntryToMap(targets[key], key, sRef, force)
 	}
-	return *s
+	return local
+}
+
+// addOccurrence adds the reference to the edges, counting the occurrences between the same symbols
+func addOccurrence(edges map[string]SymbolRef, sRef SymbolRef) {
+	key := sRef.createSymbolMapKey()
+	sRef.Count = edges[key].Count + 1
+	edges[key] = sRef
 }
 
 func (s *SymbolRef) createSymbolMapKey() string {
-	return fmt.Sprintf("%s:%s_%s:%s", s.Definition.FilePath, s.Definition.Name, s.Ref.FilePath, s.Ref.MethodName)
+	return createSymbolMapKey(s.Definition.ID, s.Ref.SymbolID, s.Relation)
 }
 
-func (s Symbol) createSymbolMapKey(refPath, methodName string) string {
-	return fmt.Sprintf("%s:%s_%s:%s", s.FilePath, s.Name, refPath, methodName)
+// createSymbolMapKey includes the relation, so an implementation does not overwrite a reference between the same symbols
+func createSymbolMapKey(defID, refID, relation string) string {
+	key := fmt.Sprintf("%s_%s", defID, refID)
+	if relation != "" {
+		key = fmt.Sprintf("%s_%s", key, relation)
+	}
+	return key
 }
 
 func addEntryToMap(m *map[string]SymbolRef, key string, sr SymbolRef, force *bool) {
@@ -178,9 +249,13 @@ func addEntryToMap(m *map[string]SymbolRef, key string, sr SymbolRef, force *boo
 func (s Symbol) createSymbol() symbol {
 	symbolRefs := make(map[string]SymbolRef)
 	for _, ref := range s.Refs {
-		symbolRefs[s.createSymbolMapKey(ref.FilePath, ref.MethodName)] = s.newSymbolRef(ref)
+		addOccurrence(symbolRefs, s.newSymbolRef(ref, ""))
+	}
+	for _, ref := range s.Implementations {
+		addOccurrence(symbolRefs, s.newSymbolRef(ref, Implements))
 	}
 	return symbol{
+		ID:       s.ID,
 		Name:     s.Name,
 		Kind:     s.Kind,
 		FilePath: s.FilePath,
@@ -207,6 +282,16 @@ func (f *Folder) GetFile(fileName, folderPath *string) *File {
 	return file
 }
 
+// Highlight marks the symbols of the file in the graph
+func (f *File) Highlight(ids ...string) {
+	for _, id := range ids {
+		if s, ok := f.Symbols[id]; ok {
+			s.Highlight = true
+			f.Symbols[id] = s
+		}
+	}
+}
+
 func (f *Folder) AddFile(file *File, forceUpdate *bool) {
 	if f.Files == nil {
 		f.Files = make(map[string]*File)
@@ -224,20 +309,22 @@ func (f *Folder) AddFile(file *File, forceUpdate *bool) {
 // This does not override the original folder
 // *f = *f.SubFolders[d] instead of f = f.SubFolders[d] will override the original folder
 // The updated local pointer is therefore returned, and the original folder how the natural path of folders
+// The paths of created folders are relative to the project, f must be the root folder of a node
 func (f *Folder) GetRelatedFolder(absPath, projectPath string) (*Folder, error) {
 	dirs, err := determineFolderPath(absPath, projectPath)
 	if err != nil {
 		return nil, err
 	}
+	folderPath := f.FolderPath
 	for _, d := range *dirs {
-		projectPath = filepath.Join(projectPath, d)
+		folderPath = filepath.Join(folderPath, d)
 
 		if f.SubFolders == nil {
 			f.SubFolders = make(map[string]*Folder)
 		}
 
 		if _, exists := f.SubFolders[d]; !exists {
-			f.SubFolders[d] = newFolder(projectPath)
+			f.SubFolders[d] = newFolder(folderPath)
 		}
 		f = f.SubFolders[d]
 	}
@@ -263,8 +350,9 @@ func determineFolderPath(absPath, projectPath string) (*[]string, error) {
 // Recursive data structure to store the project structure.
 // Used for graphviz file generation
 type RMap struct {
-	Name  string           `json:"name"`
-	Nodes map[string]*Node `json:"nodes"`
+	Version int              `json:"version"`
+	Name    string           `json:"name"`
+	Nodes   map[string]*Node `json:"nodes"`
 }
 
 type Node struct {
@@ -273,7 +361,8 @@ type Node struct {
 }
 
 type Folder struct {
-	FolderName string               `json:"folderName"`
+	FolderName string `json:"folderName"`
+	// FolderPath is relative to the project, "." for the root folder of a node
 	FolderPath string               `json:"folderPath"`
 	Refs       map[string]SymbolRef `json:"refs,omitempty"`
 	Files      map[string]*File     `json:"files,omitempty"`
@@ -281,20 +370,32 @@ type Folder struct {
 }
 
 type File struct {
-	Name    string               `json:"name,omitempty"`
-	Path    string               `json:"path,omitempty"`
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+	// Added is true if the file was added to the map, and false if it only contains referencing symbols
+	Added   bool                 `json:"added,omitempty"`
 	Refs    map[string]SymbolRef `json:"refs,omitempty"`
 	Symbols map[string]symbol    `json:"symbols,omitempty"`
 }
 
 type symbol struct {
+	ID       string               `json:"id,omitempty"`
 	Name     string               `json:"name,omitempty"`
 	Kind     string               `json:"kind,omitempty"`
 	FilePath string               `json:"path,omitempty"`
 	Refs     map[string]SymbolRef `json:"refs,omitempty"`
+	// Highlight marks the symbol in the graph, e.g. unreachable symbols
+	Highlight bool `json:"highlight,omitempty"`
 }
 
+// Implements is the relation of a type implementing the interface it refers to
+const Implements = "implements"
+
 type SymbolRef struct {
 	Definition symbol `json:"definition"`
 	Ref        Ref    `json:"reference"`
+	// Relation is empty for references and Implements for implementations
+	Relation string `json:"relation,omitempty"`
+	// Count is the number of occurrences of the reference, Ref is one of them
+	Count int `json:"count,omitempty"`
 }
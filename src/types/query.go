@@ -0,0 +1,123 @@
+package types
+
+import (
+	"sort"
+)
+
+// Definition is a cached symbol, with the path of the entry it is declared in
+type Definition struct {
+	RelPath string
+	Symbol  *Symbol
+}
+
+// Edge is a symbol referencing another symbol, with every occurrence of the reference
+// Depth is 1 for the queried symbol and increases by one for each transitive step
+type Edge struct {
+	From        string
+	To          string
+	Depth       int
+	Occurrences []*Ref
+}
+
+// FindDefinitions returns the symbols accepted by match, sorted by id
+func (c *Cache) FindDefinitions(match func(*Symbol) bool) []Definition {
+	c.Mu.RLock()
+	defer c.Mu.RUnlock()
+
+	var defs []Definition
+	for relPath, entry := range c.Entries {
+		for _, s := range entry.Symbols {
+			if match(s) {
+				defs = append(defs, Definition{RelPath: relPath, Symbol: s})
+			}
+		}
+	}
+	sort.Slice(defs, func(i, j int) bool {
+		if defs[i].Symbol.ID != defs[j].Symbol.ID {
+			return defs[i].Symbol.ID < defs[j].Symbol.ID
+		}
+		return defs[i].RelPath < defs[j].RelPath
+	})
+	return defs
+}
+
+// Callers returns the symbols referencing the symbol, and their callers up to the depth
+// A depth less than 1 has no limit
+func (c *Cache) Callers(id string, depth int) []Edge {
+	c.Mu.RLock()
+	defer c.Mu.RUnlock()
+
+	refs := make(map[string][]*Ref)
+	for _, entry := range c.Entries {
+		for id, s := range entry.Symbols {
+			for _, ref := range s.Refs {
+				refs[id] = append(refs[id], ref)
+			}
+		}
+	}
+	return walk(id, depth, func(id string) map[string][]*Ref {
+		edges := make(map[string][]*Ref)
+		for _, ref := range refs[id] {
+			edges[ref.SymbolID] = append(edges[ref.SymbolID], ref)
+		}
+		return edges
+	}, true)
+}
+
+// Callees returns the symbols referenced by the symbol, and what they reference up to the depth
+// A depth less than 1 has no limit
+func (c *Cache) Callees(id string, depth int) []Edge {
+	c.Mu.RLock()
+	defer c.Mu.RUnlock()
+
+	uses := make(map[string]map[string][]*Ref)
+	for _, entry := range c.Entries {
+		for id, s := range entry.Symbols {
+			for _, ref := range s.Refs {
+				if uses[ref.SymbolID] == nil {
+					uses[ref.SymbolID] = make(map[string][]*Ref)
+				}
+				uses[ref.SymbolID][id] = append(uses[ref.SymbolID][id], ref)
+			}
+		}
+	}
+	return walk(id, depth, func(id string) map[string][]*Ref {
+		return uses[id]
+	}, false)
+}
+
+// walk visits the symbols breadth first, each symbol is expanded once
+// next returns the neighbours of a symbol with the occurrences of the references between them
+func walk(id string, depth int, next func(id string) map[string][]*Ref, callers bool) []Edge {
+	var edges []Edge
+	visited := map[string]bool{id: true}
+	level := []string{id}
+	for d := 1; len(level) > 0 && (depth < 1 || d <= depth); d++ {
+		var nextLevel []string
+		for _, current := range level {
+			for neighbour, occurrences := range next(current) {
+				sort.Slice(occurrences, func(i, j int) bool { return occurrences[i].Path < occurrences[j].Path })
+				edge := Edge{From: current, To: neighbour, Depth: d, Occurrences: occurrences}
+				if callers {
+					edge.From, edge.To = neighbour, current
+				}
+				edges = append(edges, edge)
+				if !visited[neighbour] {
+					visited[neighbour] = true
+					nextLevel = append(nextLevel, neighbour)
+				}
+			}
+		}
+		level = nextLevel
+	}
+	sort.SliceStable(edges, func(i, j int) bool {
+		if edges[i].Depth != edges[j].Depth {
+			return edges[i].Depth < edges[j].Depth
+		}
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+	return edges
+}
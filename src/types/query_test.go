@@ -0,0 +1,45 @@
+package types
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCallersAndCallees(t *testing.T) {
+	c := NewCache()
+	// main calls Foo twice, Foo and Other call Bar, Bar calls itself
+	c.AddEntry("a.go", &CacheEntry{Symbols: map[string]*Symbol{
+		"Bar#Function": {Refs: map[string]*Ref{
+			"a.go:5:2-5": {Path: "a.go:5:2-5", SymbolID: "Foo#Function"},
+			"b.go:3:2-5": {Path: "b.go:3:2-5", SymbolID: "Other#Function"},
+			"a.go:9:2-5": {Path: "a.go:9:2-5", SymbolID: "Bar#Function"},
+		}},
+		"Foo#Function": {Refs: map[string]*Ref{
+			"a.go:2:2-5": {Path: "a.go:2:2-5", SymbolID: "main#Function"},
+			"a.go:3:2-5": {Path: "a.go:3:2-5", SymbolID: "main#Function"},
+		}},
+		"main#Function": {},
+	}})
+
+	format := func(edges []Edge) string {
+		var s string
+		for _, e := range edges {
+			s += fmt.Sprintf("%d:%s->%s(%d) ", e.Depth, e.From, e.To, len(e.Occurrences))
+		}
+		return s
+	}
+	for _, test := range []struct {
+		name  string
+		edges []Edge
+		want  string
+	}{
+		{"callers", c.Callers("Bar#Function", 1), "1:Bar#Function->Bar#Function(1) 1:Foo#Function->Bar#Function(1) 1:Other#Function->Bar#Function(1) "},
+		{"transitive callers", c.Callers("Bar#Function", 0), "1:Bar#Function->Bar#Function(1) 1:Foo#Function->Bar#Function(1) 1:Other#Function->Bar#Function(1) 2:main#Function->Foo#Function(2) "},
+		{"callees", c.Callees("main#Function", 1), "1:main#Function->Foo#Function(2) "},
+		{"transitive callees", c.Callees("main#Function", 3), "1:main#Function->Foo#Function(2) 2:Foo#Function->Bar#Function(1) 3:Bar#Function->Bar#Function(1) "},
+	} {
+		if got := format(test.edges); got != test.want {
+			t.Errorf("%s: expected %s, got %s", test.name, test.want, got)
+		}
+	}
+}
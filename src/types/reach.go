@@ -0,0 +1,127 @@
+package types
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// testRoot matches the functions run by go test
+var testRoot = regexp.MustCompile(`^(Test|Benchmark|Example|Fuzz)`)
+
+// Unreachable returns the scanned symbols which can not be reached from a root through the cached references
+// The roots are main, init, the test functions, the exported symbols of packages without a main function,
+// symbols referenced outside of any symbol, e.g. by package level variables, and the symbols accepted by isRoot
+// Types reach their fields, and the methods named like a method of a cached interface, as they may be called through it
+func (c *Cache) Unreachable(f UnusedFilter, isRoot func(id string) bool) []Definition {
+	c.Mu.RLock()
+	defer c.Mu.RUnlock()
+
+	symbols := make(map[string]*Symbol)
+	relPaths := make(map[string]string)
+	// uses maps a symbol to the symbols it references
+	uses := make(map[string][]string)
+	// members maps a type, its id without the kind, to its fields and methods
+	members := make(map[string][]string)
+	ifaceMethods := make(map[string]bool)
+	mains := make(map[string]bool)
+	for relPath, entry := range c.Entries {
+		for id, s := range entry.Symbols {
+			symbols[id] = s
+			relPaths[id] = relPath
+			if s.Name == "main" && s.Kind == "Function" {
+				mains[filepath.Dir(relPath)] = true
+			}
+			for _, ref := range s.Refs {
+				uses[ref.SymbolID] = append(uses[ref.SymbolID], id)
+			}
+		}
+	}
+	// keys are the ids of the symbols without the kind, by package directory
+	keys := make(map[string]map[string]bool)
+	for id := range symbols {
+		dir := filepath.Dir(relPaths[id])
+		if keys[dir] == nil {
+			keys[dir] = make(map[string]bool)
+		}
+		key, _, _ := strings.Cut(id, "#")
+		keys[dir][key] = true
+	}
+	for id, s := range symbols {
+		parent := parentOf(id, keys[filepath.Dir(relPaths[id])])
+		if parent == "" {
+			continue
+		}
+		members[parent] = append(members[parent], id)
+		if s.Kind == "Method" && symbols[parent+"#Interface"] != nil {
+			ifaceMethods[s.Name] = true
+		}
+	}
+
+	reached := make(map[string]bool)
+	var queue []string
+	reach := func(id string) {
+		if !reached[id] {
+			reached[id] = true
+			queue = append(queue, id)
+		}
+	}
+	// references outside of any symbol have no symbol id
+	for _, id := range uses[""] {
+		reach(id)
+	}
+	for id, s := range symbols {
+		relPath := relPaths[id]
+		switch {
+		case s.Kind == "Function" && (s.Name == "main" || s.Name == "init"):
+		case isTestFile(relPath) && s.Kind == "Function" && testRoot.MatchString(s.Name):
+		case !mains[filepath.Dir(relPath)] && !isTestFile(relPath) && IsExported(s.Name):
+		case isRoot != nil && isRoot(id):
+		default:
+			continue
+		}
+		reach(id)
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, used := range uses[id] {
+			reach(used)
+		}
+		key, _, _ := strings.Cut(id, "#")
+		for _, member := range members[key] {
+			if s := symbols[member]; s.Kind != "Method" || ifaceMethods[s.Name] || symbols[id].Kind == "Interface" {
+				reach(member)
+			}
+		}
+	}
+
+	var unreachable []Definition
+	for id, s := range symbols {
+		relPath := relPaths[id]
+		scanned := s.ZeroRefs || len(s.Refs) > 0
+		if reached[id] || !scanned || isTestFile(relPath) || !f.keep(id, s) {
+			continue
+		}
+		unreachable = append(unreachable, Definition{RelPath: relPath, Symbol: s})
+	}
+	sort.Slice(unreachable, func(i, j int) bool {
+		if unreachable[i].RelPath != unreachable[j].RelPath {
+			return unreachable[i].RelPath < unreachable[j].RelPath
+		}
+		return unreachable[i].Symbol.ID < unreachable[j].Symbol.ID
+	})
+	return unreachable
+}
+
+// parentOf returns the type a field or method id belongs to, without the kind
+// keys are the ids of the symbols in the package without the kind, top-level symbols have no parent since their package is not a symbol
+func parentOf(id string, keys map[string]bool) string {
+	key, _, _ := strings.Cut(id, "#")
+	i := strings.LastIndex(key, ".")
+	if i < 0 || strings.Contains(key[i:], "/") || !keys[key[:i]] {
+		return ""
+	}
+	return key[:i]
+}
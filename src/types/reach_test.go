@@ -0,0 +1,53 @@
+package types
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnreachable(t *testing.T) {
+	ref := func(caller string) map[string]*Ref {
+		return map[string]*Ref{caller: {SymbolID: caller}}
+	}
+	c := NewCache()
+	c.AddEntry("cmd/main.go", &CacheEntry{Symbols: map[string]*Symbol{
+		"cmd.main#Function":     {Name: "main", Kind: "Function"},
+		"cmd.run#Function":      {Name: "run", Kind: "Function", Refs: ref("cmd.main#Function")},
+		"cmd.T#Struct":          {Name: "T", Kind: "Struct", Refs: ref("cmd.run#Function")},
+		"cmd.T.Run#Method":      {Name: "Run", Kind: "Method", ZeroRefs: true},
+		"cmd.T.unused#Method":   {Name: "unused", Kind: "Method", ZeroRefs: true},
+		"cmd.Runner#Interface":  {Name: "Runner", Kind: "Interface", ZeroRefs: true},
+		"cmd.Runner.Run#Method": {Name: "Run", Kind: "Method", ZeroRefs: true},
+		// ping and pong only call each other
+		"cmd.ping#Function":   {Name: "ping", Kind: "Function", Refs: ref("cmd.pong#Function")},
+		"cmd.pong#Function":   {Name: "pong", Kind: "Function", Refs: ref("cmd.ping#Function")},
+		"cmd.tested#Function": {Name: "tested", Kind: "Function", Refs: ref("cmd.TestTested#Function")},
+		"cmd.Kept#Function":   {Name: "Kept", Kind: "Function", ZeroRefs: true},
+	}})
+	c.AddEntry("cmd/main_test.go", &CacheEntry{Symbols: map[string]*Symbol{
+		"cmd.TestTested#Function": {Name: "TestTested", Kind: "Function"},
+	}})
+	c.AddEntry("lib/lib.go", &CacheEntry{Symbols: map[string]*Symbol{
+		"lib.API#Function":    {Name: "API", Kind: "Function", ZeroRefs: true},
+		"lib.helper#Function": {Name: "helper", Kind: "Function", Refs: ref("lib.API#Function")},
+		"lib.dead#Function":   {Name: "dead", Kind: "Function", ZeroRefs: true},
+	}})
+	// the type lib of the root package is not the parent of the symbols of the lib package
+	c.AddEntry("types.go", &CacheEntry{Symbols: map[string]*Symbol{
+		"lib#Struct": {Name: "lib", Kind: "Struct", Refs: ref("cmd.run#Function")},
+	}})
+
+	for _, entry := range c.Entries {
+		for id, s := range entry.Symbols {
+			s.ID = id
+		}
+	}
+	var ids []string
+	for _, d := range c.Unreachable(UnusedFilter{}, func(id string) bool { return id == "cmd.Kept#Function" }) {
+		ids = append(ids, d.Symbol.ID)
+	}
+	want := "cmd.Runner#Interface,cmd.Runner.Run#Method,cmd.T.unused#Method,cmd.ping#Function,cmd.pong#Function,lib.dead#Function"
+	if got := strings.Join(ids, ","); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
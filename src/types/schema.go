@@ -0,0 +1,277 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Versions of the files written by RefViz, increased when a change to the types breaks existing files
+// Files written before versions were added are version 0
+const (
+	CacheVersion  = 3
+	ConfigVersion = 1
+	MapVersion    = 2
+)
+
+type Schema string
+
+const (
+	CacheSchema  Schema = "cache"
+	ConfigSchema Schema = "config"
+	MapSchema    Schema = "map"
+)
+
+var versions = map[Schema]int{
+	CacheSchema:  CacheVersion,
+	ConfigSchema: ConfigVersion,
+	MapSchema:    MapVersion,
+}
+
+// migrations upgrade the raw json of a file from the version of their index to the next version
+var migrations = map[Schema][]func(raw map[string]any) error{
+	CacheSchema:  {dropUnidentifiedEntries, relativeCachePaths, dropSharedIDs},
+	ConfigSchema: {unchanged},
+	MapSchema:    {unchanged, relativeMapPaths},
+}
+
+// SchemaError is returned for files which can not be migrated to the current version
+// Version is -1 if the file is not valid json
+type SchemaError struct {
+	Schema  Schema
+	Version int
+	Err     error
+}
+
+func (e *SchemaError) Error() string {
+	if e.Version < 0 {
+		return fmt.Sprintf("%s can not be read: %v", e.Schema, e.Err)
+	}
+	return fmt.Sprintf("%s version %d can not be migrated to version %d: %v", e.Schema, e.Version, versions[e.Schema], e.Err)
+}
+
+func (e *SchemaError) Unwrap() error {
+	return e.Err
+}
+
+// Decode migrates the json to the current version of the schema and unmarshals it into v
+// Returns the version of the json before it was migrated
+func Decode(schema Schema, data []byte, v any) (int, error) {
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return -1, &SchemaError{Schema: schema, Version: -1, Err: err}
+	}
+	version, err := Migrate(schema, raw)
+	if err != nil {
+		return version, err
+	}
+	data, err = json.Marshal(raw)
+	if err != nil {
+		return version, &SchemaError{Schema: schema, Version: version, Err: err}
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return version, &SchemaError{Schema: schema, Version: version, Err: err}
+	}
+	return version, nil
+}
+
+// Migrate runs the migrations from the version of the raw json to the current version
+// Returns the version of the json before it was migrated
+func Migrate(schema Schema, raw map[string]any) (int, error) {
+	var version int
+	if v, ok := raw["version"].(float64); ok {
+		version = int(v)
+	}
+	current := versions[schema]
+	if version > current {
+		return version, &SchemaError{Schema: schema, Version: version, Err: fmt.Errorf("written by a newer version of RefViz")}
+	}
+	for v := version; v < current; v++ {
+		if err := migrations[schema][v](raw); err != nil {
+			return version, &SchemaError{Schema: schema, Version: version, Err: err}
+		}
+	}
+	raw["version"] = current
+	return version, nil
+}
+
+func unchanged(raw map[string]any) error {
+	return nil
+}
+
+// dropUnidentifiedEntries removes the entries with symbols from before symbols had ids, they are scanned again
+func dropUnidentifiedEntries(raw map[string]any) error {
+	entries, _ := raw["entries"].(map[string]any)
+	unused, _ := raw["UnusedSymbols"].(map[string]any)
+	for relPath, e := range entries {
+		entry, ok := e.(map[string]any)
+		if !ok {
+			return fmt.Errorf("invalid entry: %s", relPath)
+		}
+		symbols, _ := entry["symbols"].(map[string]any)
+		for _, s := range symbols {
+			if symbol, ok := s.(map[string]any); !ok || symbol["id"] == nil {
+				delete(entries, relPath)
+				delete(unused, relPath)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// dropSharedIDs removes the entries of test files and files with init functions, whose symbols shared ids before
+// external test packages and init functions got ids of their own. They are scanned again
+// Symbols referenced from test files or init functions are marked as stale, so their references get the new ids
+func dropSharedIDs(raw map[string]any) error {
+	entries, _ := raw["entries"].(map[string]any)
+	unused, _ := raw["UnusedSymbols"].(map[string]any)
+	for relPath, e := range entries {
+		entry, ok := e.(map[string]any)
+		if !ok {
+			return fmt.Errorf("invalid entry: %s", relPath)
+		}
+		symbols, _ := entry["symbols"].(map[string]any)
+		drop := strings.HasSuffix(relPath, "_test.go")
+		for id := range symbols {
+			drop = drop || isInitID(id)
+		}
+		if drop {
+			delete(entries, relPath)
+			delete(unused, relPath)
+			continue
+		}
+		for _, s := range symbols {
+			symbol, _ := s.(map[string]any)
+			refs, _ := symbol["refs"].(map[string]any)
+			for _, r := range refs {
+				ref, _ := r.(map[string]any)
+				filePath, _ := ref["filepath"].(string)
+				symbolID, _ := ref["symbolId"].(string)
+				if strings.HasSuffix(filePath, "_test.go") || isInitID(symbolID) {
+					symbol["stale"] = true
+					break
+				}
+			}
+		}
+	}
+	for relPath, u := range unused {
+		if strings.HasSuffix(relPath, "_test.go") {
+			delete(unused, relPath)
+			continue
+		}
+		symbols, _ := u.(map[string]any)
+		for id := range symbols {
+			if isInitID(id) {
+				delete(symbols, id)
+			}
+		}
+		if len(symbols) == 0 {
+			delete(unused, relPath)
+		}
+	}
+	return nil
+}
+
+// isInitID reports whether the id is the id init functions had before they were told apart
+func isInitID(id string) bool {
+	return id == "init#Function" || strings.HasSuffix(id, ".init#Function")
+}
+
+// relativeCachePaths makes the absolute paths of the symbols, references and failed commands relative to the project
+// The project root is where the cache was written, found from a path ending with the relative path of its entry
+func relativeCachePaths(raw map[string]any) error {
+	root := cacheRoot(raw)
+	if root == "" {
+		return nil
+	}
+	for _, key := range []string{"entries", "UnusedSymbols"} {
+		if v, ok := raw[key]; ok {
+			raw[key] = relativize(v, root)
+		}
+	}
+	commands, _ := raw["errors"].([]any)
+	for i, c := range commands {
+		if command, ok := c.(string); ok {
+			commands[i] = strings.ReplaceAll(command, " "+root+string(filepath.Separator), " ")
+		}
+	}
+	return nil
+}
+
+// cacheRoot returns the project root of a cache with absolute paths, or an empty string if it has none
+func cacheRoot(raw map[string]any) string {
+	sep := string(filepath.Separator)
+	entries, _ := raw["entries"].(map[string]any)
+	for relPath, e := range entries {
+		entry, _ := e.(map[string]any)
+		symbols, _ := entry["symbols"].(map[string]any)
+		for _, s := range symbols {
+			symbol, _ := s.(map[string]any)
+			filePath, _ := symbol["filePath"].(string)
+			if root, ok := strings.CutSuffix(filePath, sep+relPath); ok && filepath.IsAbs(filePath) {
+				return root
+			}
+		}
+	}
+	// the entries of sharded caches are not in the main file
+	unused, _ := raw["UnusedSymbols"].(map[string]any)
+	for relPath, u := range unused {
+		symbols, _ := u.(map[string]any)
+		for _, s := range symbols {
+			symbol, _ := s.(map[string]any)
+			location, _ := symbol["location"].(string)
+			if root, _, ok := strings.Cut(location, sep+relPath+":"); ok && filepath.IsAbs(location) {
+				return root
+			}
+		}
+	}
+	return ""
+}
+
+// relativeMapPaths makes the absolute paths of the folders, files and symbols relative to the project
+// The project root is the path of the root folder of the nodes
+func relativeMapPaths(raw map[string]any) error {
+	nodes, _ := raw["nodes"].(map[string]any)
+	for _, n := range nodes {
+		node, _ := n.(map[string]any)
+		rootFolder, _ := node["rootFolder"].(map[string]any)
+		if root, _ := rootFolder["folderPath"].(string); filepath.IsAbs(root) {
+			raw["nodes"] = relativize(nodes, filepath.Clean(root))
+			return nil
+		}
+	}
+	return nil
+}
+
+// relativize replaces the paths below the root in the keys and values of the json with relative paths
+func relativize(v any, root string) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for key, value := range v {
+			m[relativePath(key, root)] = relativize(value, root)
+		}
+		return m
+	case []any:
+		for i := range v {
+			v[i] = relativize(v[i], root)
+		}
+		return v
+	case string:
+		return relativePath(v, root)
+	}
+	return v
+}
+
+// relativePath trims the root from the path, strings which are not below the root are returned as they are
+func relativePath(path, root string) string {
+	if path == root {
+		return "."
+	}
+	if rel, ok := strings.CutPrefix(path, root+string(filepath.Separator)); ok {
+		return rel
+	}
+	return path
+}
@@ -0,0 +1,90 @@
+package types
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	old := []byte(`{"entries": {
+		"a.go": {"symbols": {"Foo": {"name": "Foo"}}},
+		"b.go": {"symbols": {"Bar#Function": {"id": "Bar#Function", "name": "Bar"}}}
+	}, "UnusedSymbols": {"a.go": {"Foo": {}}}}`)
+	c := NewCache()
+	version, err := Decode(CacheSchema, old, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 0 || c.Version != CacheVersion {
+		t.Errorf("expected version 0 migrated to %d, got %d migrated to %d", CacheVersion, version, c.Version)
+	}
+	if _, ok := c.Entries["a.go"]; ok || len(c.UnusedSymbols) != 0 {
+		t.Error("expected the entry with symbols without ids to be dropped")
+	}
+	if _, ok := c.Entries["b.go"]; !ok {
+		t.Error("expected the entry with identified symbols to be kept")
+	}
+
+	var serr *SchemaError
+	if _, err := Decode(MapSchema, []byte(`{"version": 99}`), NewMap(new(string))); !errors.As(err, &serr) {
+		t.Errorf("expected a schema error for a newer version, got %v", err)
+	}
+	if _, err := Decode(ConfigSchema, []byte(`{"includedExtensions": 1}`), NewConfig()); !errors.As(err, &serr) {
+		t.Errorf("expected a schema error for an invalid file, got %v", err)
+	}
+}
+
+func TestRelativePaths(t *testing.T) {
+	old := []byte(`{"version": 1, "errors": ["native references /p/b.go:3:2-5"], "entries": {
+		"a.go": {"symbols": {"Foo#Function": {"id": "Foo#Function", "path": "/p/a.go:1:6-9", "filePath": "/p/a.go", "refs": {
+			"/p/b.go:3:2-5": {"filepath": "/p/b.go", "path": "/p/b.go:3:2-5"}
+		}}}}
+	}}`)
+	c := NewCache()
+	if _, err := Decode(CacheSchema, old, c); err != nil {
+		t.Fatal(err)
+	}
+	foo := c.Entries["a.go"].Symbols["Foo#Function"]
+	if foo.FilePath != "a.go" || foo.Path != "a.go:1:6-9" {
+		t.Errorf("expected the symbol paths to be relative, got %s and %s", foo.FilePath, foo.Path)
+	}
+	if ref, ok := foo.Refs["b.go:3:2-5"]; !ok || ref.FilePath != "b.go" || ref.Path != "b.go:3:2-5" {
+		t.Errorf("expected the reference and its key to be relative, got %v", foo.Refs)
+	}
+	if len(c.Errors) != 1 || c.Errors[0] != "native references b.go:3:2-5" {
+		t.Errorf("expected the failed command to be relative, got %v", c.Errors)
+	}
+
+	m := NewMap(new(string))
+	if _, err := Decode(MapSchema, []byte(`{"version": 1, "nodes": {"n": {"rootFolder": {"folderName": "p", "folderPath": "/p", "subFolders": {
+		"b": {"folderName": "b", "folderPath": "/p/b", "files": {"b.go": {"name": "b.go", "path": "/p/b"}}}
+	}}}}}`), m); err != nil {
+		t.Fatal(err)
+	}
+	root := m.Nodes["n"].RootFolder
+	if root.FolderPath != "." || root.FolderName != "p" || root.SubFolders["b"].FolderPath != "b" || root.SubFolders["b"].Files["b.go"].Path != "b" {
+		t.Errorf("expected the folder and file paths to be relative, got %+v", root.SubFolders["b"])
+	}
+}
+
+func TestDropSharedIDs(t *testing.T) {
+	old := []byte(`{"version": 2, "entries": {
+		"a.go": {"symbols": {
+			"Foo#Function": {"id": "Foo#Function", "refs": {"a_test.go:3:2-5": {"filepath": "a_test.go", "symbolId": "TestFoo#Function"}}},
+			"Bar#Function": {"id": "Bar#Function", "refs": {"b.go:3:2-5": {"filepath": "b.go", "symbolId": "Baz#Function"}}}
+		}},
+		"a_test.go": {"symbols": {"TestFoo#Function": {"id": "TestFoo#Function"}}},
+		"b.go": {"symbols": {"init#Function": {"id": "init#Function"}, "Baz#Function": {"id": "Baz#Function"}}}
+	}}`)
+	c := NewCache()
+	if _, err := Decode(CacheSchema, old, c); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Entries) != 1 {
+		t.Errorf("expected the entries of the test file and the file with an init function to be dropped, got %d entries", len(c.Entries))
+	}
+	symbols := c.Entries["a.go"].Symbols
+	if !symbols["Foo#Function"].Stale || symbols["Bar#Function"].Stale {
+		t.Error("expected only the symbol referenced from the test file to be stale")
+	}
+}
@@ -0,0 +1,89 @@
+package types
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	Exported   = "exported"
+	Unexported = "unexported"
+)
+
+// UnusedFilter selects the symbols reported as unused
+type UnusedFilter struct {
+	// Kinds are the reported kinds, every kind is reported if empty
+	Kinds map[string]bool
+	// Visibility is Exported, Unexported or empty for both
+	Visibility string
+	// TestRefs counts references from _test.go files as uses
+	TestRefs bool
+	// Allowed symbols are never reported
+	Allowed func(id string) bool
+}
+
+// Unused returns the scanned symbols without references, sorted by entry and id
+// Symbols declared in _test.go files are skipped, and unless TestRefs is set, so are references from them
+func (c *Cache) Unused(f UnusedFilter) []Definition {
+	c.Mu.RLock()
+	defer c.Mu.RUnlock()
+
+	var unused []Definition
+	for relPath, entry := range c.Entries {
+		if isTestFile(relPath) {
+			continue
+		}
+		for id, s := range entry.Symbols {
+			if !f.keep(id, s) || !isUnused(s, f.TestRefs) {
+				continue
+			}
+			unused = append(unused, Definition{RelPath: relPath, Symbol: s})
+		}
+	}
+	sort.Slice(unused, func(i, j int) bool {
+		if unused[i].RelPath != unused[j].RelPath {
+			return unused[i].RelPath < unused[j].RelPath
+		}
+		return unused[i].Symbol.ID < unused[j].Symbol.ID
+	})
+	return unused
+}
+
+func (f UnusedFilter) keep(id string, s *Symbol) bool {
+	if len(f.Kinds) > 0 && !f.Kinds[s.Kind] {
+		return false
+	}
+	if f.Visibility != "" && (f.Visibility == Exported) != IsExported(s.Name) {
+		return false
+	}
+	return f.Allowed == nil || !f.Allowed(id)
+}
+
+// isUnused reports whether the symbol was scanned and found without references
+// Symbols which are not scanned yet have neither references nor ZeroRefs set
+func isUnused(s *Symbol, testRefs bool) bool {
+	if s.ZeroRefs {
+		return true
+	}
+	if testRefs || len(s.Refs) == 0 {
+		return false
+	}
+	for _, ref := range s.Refs {
+		if !isTestFile(ref.FilePath) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsExported reports whether the name starts with an upper case letter
+func IsExported(name string) bool {
+	r, _ := utf8.DecodeRuneInString(name)
+	return unicode.IsUpper(r)
+}
+
+func isTestFile(path string) bool {
+	return strings.HasSuffix(path, "_test.go")
+}
@@ -0,0 +1,44 @@
+package types
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnused(t *testing.T) {
+	c := NewCache()
+	c.AddEntry("a.go", &CacheEntry{Symbols: map[string]*Symbol{
+		"Used#Function":     {ID: "Used#Function", Name: "Used", Kind: "Function", Refs: map[string]*Ref{"b.go:1:1-5": {FilePath: "b.go"}}},
+		"Tested#Function":   {ID: "Tested#Function", Name: "Tested", Kind: "Function", Refs: map[string]*Ref{"a_test.go:1:1-5": {FilePath: "a_test.go"}}},
+		"Dead#Function":     {ID: "Dead#Function", Name: "Dead", Kind: "Function", ZeroRefs: true},
+		"dead#Function":     {ID: "dead#Function", Name: "dead", Kind: "Function", ZeroRefs: true},
+		"T.Dead#Method":     {ID: "T.Dead#Method", Name: "Dead", Kind: "Method", ZeroRefs: true},
+		"NotScanned#Struct": {ID: "NotScanned#Struct", Name: "NotScanned", Kind: "Struct"},
+	}})
+	c.AddEntry("a_test.go", &CacheEntry{Symbols: map[string]*Symbol{
+		"helper#Function": {ID: "helper#Function", Name: "helper", Kind: "Function", ZeroRefs: true},
+	}})
+
+	ids := func(defs []Definition) string {
+		var s []string
+		for _, d := range defs {
+			s = append(s, d.Symbol.ID)
+		}
+		return strings.Join(s, ",")
+	}
+	for _, test := range []struct {
+		name   string
+		filter UnusedFilter
+		want   string
+	}{
+		{"all", UnusedFilter{}, "Dead#Function,T.Dead#Method,Tested#Function,dead#Function"},
+		{"test refs", UnusedFilter{TestRefs: true}, "Dead#Function,T.Dead#Method,dead#Function"},
+		{"kind", UnusedFilter{Kinds: map[string]bool{"Method": true}}, "T.Dead#Method"},
+		{"unexported", UnusedFilter{Visibility: Unexported}, "dead#Function"},
+		{"allowed", UnusedFilter{Allowed: func(id string) bool { return strings.HasPrefix(id, "T.") }}, "Dead#Function,Tested#Function,dead#Function"},
+	} {
+		if got := ids(c.Unused(test.filter)); got != test.want {
+			t.Errorf("%s: expected %s, got %s", test.name, test.want, got)
+		}
+	}
+}